@@ -0,0 +1,57 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+)
+
+// Exit codes of "ditto check". Both drift codes are combined when both kinds
+// of drift are found; errors exit with 1 like every other command.
+const (
+	CheckInSync    = 0
+	CheckMissing   = 2
+	CheckUnmanaged = 4
+)
+
+// Check computes the diff like a sync and reports drift on stderr, without
+// prompting or changing anything. It returns the exit code to use.
+func Check(opts SyncOptions, appCtx *AppContext) (int, error) {
+	state, err := prepareSync(context.Background(), opts, appCtx)
+	if err != nil {
+		return 0, err
+	}
+
+	missing := state.Diff.ToAdd
+	unmanaged := state.Diff.ToRemoveFromDitto
+	var notExplicit []string
+	if opts.Strict {
+		notExplicit = state.Diff.ToMarkExplicit
+		unmanaged = slices.Concat(unmanaged, state.Diff.ToRemove)
+	}
+
+	code := CheckInSync
+	var summary []string
+	if len(missing) > 0 {
+		code |= CheckMissing
+		summary = append(summary, fmt.Sprintf("%d missing: %s", len(missing), strings.Join(missing, ", ")))
+	}
+	if len(notExplicit) > 0 {
+		code |= CheckMissing
+		summary = append(summary, fmt.Sprintf("%d installed as dependencies: %s", len(notExplicit), strings.Join(notExplicit, ", ")))
+	}
+	if len(unmanaged) > 0 {
+		code |= CheckUnmanaged
+		summary = append(summary, fmt.Sprintf("%d unmanaged: %s", len(unmanaged), strings.Join(unmanaged, ", ")))
+	}
+
+	if code == CheckInSync {
+		fmt.Fprintf(os.Stderr, "%s is in sync.\n", state.Hostname)
+	} else {
+		fmt.Fprintf(os.Stderr, "%s drifted: %s\n", state.Hostname, strings.Join(summary, "; "))
+	}
+
+	return code, nil
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ony-boom/ditto/database"
+)
+
+// TestCheckExitCodes checks test-host against the local database fixture,
+// where zsh and man-db are explicit, and bash and groff dependencies
+func TestCheckExitCodes(t *testing.T) {
+	tests := []struct {
+		name    string
+		defs    string
+		managed []string
+		strict  bool
+		want    int
+		wantErr bool
+	}{
+		{name: "in sync", defs: "zsh\nman-db\n", want: CheckInSync},
+		{name: "unlisted explicit package", defs: "zsh\n", want: CheckInSync},
+		{name: "missing package", defs: "zsh\nman-db\nneovim\n", want: CheckMissing},
+		{name: "unmanaged package", defs: "zsh\n", managed: []string{"man-db"}, want: CheckUnmanaged},
+		{name: "missing and unmanaged packages", defs: "zsh\nneovim\n", managed: []string{"man-db"}, want: CheckMissing | CheckUnmanaged},
+		{name: "strict dependency", defs: "zsh\nman-db\ngroff\n", strict: true, want: CheckMissing},
+		{name: "strict unlisted explicit package", defs: "zsh\n", strict: true, want: CheckUnmanaged},
+		// Errors exit with 1 like every other command
+		{name: "invalid definitions", defs: "zsh\n[end]\n", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			appCtx := newTestAppContext(t, "")
+			if err := os.MkdirAll(appCtx.PackageDef.path, 0o755); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.WriteFile(filepath.Join(appCtx.PackageDef.path, "base.pkgs"), []byte(tt.defs), 0o644); err != nil {
+				t.Fatal(err)
+			}
+			for _, name := range tt.managed {
+				params := database.CreatePackageParams{Host: "test-host", Scope: globalScope, Name: name}
+				if _, err := appCtx.QueryClient.CreatePackage(context.Background(), params); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			code, err := Check(SyncOptions{Host: "test-host", Strict: tt.strict}, appCtx)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Check() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if code != tt.want {
+				t.Errorf("Check() = %d, want %d", code, tt.want)
+			}
+		})
+	}
+}
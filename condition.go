@@ -0,0 +1,127 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Directives of definition files, gating the lines between "[if ...]" and
+// "[end]" on a fact of the machine
+const (
+	DIRECTIVE_ELSE = "[else]"
+	DIRECTIVE_END  = "[end]"
+)
+
+var ifDirective = regexp.MustCompile(`^\[\s*if\s+([A-Za-z0-9_.]+)\s*(==|!=)\s*("(?:[^"\\]|\\.)*")\s*\]$`)
+
+// Condition is the test of an "[if fact == "value"]" line, true when one of
+// the values of the fact equals value, or none does with "!="
+type Condition struct {
+	Fact    string
+	Negated bool
+	Value   string
+}
+
+func (c Condition) Holds(facts Facts) bool {
+	return slices.Contains(facts[c.Fact], c.Value) != c.Negated
+}
+
+// Not returns the condition of the "[else]" branch
+func (c Condition) Not() Condition {
+	c.Negated = !c.Negated
+	return c
+}
+
+func (c Condition) String() string {
+	op := "=="
+	if c.Negated {
+		op = "!="
+	}
+	return fmt.Sprintf("%s %s %s", c.Fact, op, strconv.Quote(c.Value))
+}
+
+// Directive renders the "[if ...]" line of the condition
+func (c Condition) Directive() string {
+	return "[if " + c.String() + "]"
+}
+
+// Conditions are the conditions of the blocks enclosing a line, which all have to hold
+type Conditions []Condition
+
+func (cs Conditions) Holds(facts Facts) bool {
+	for _, c := range cs {
+		if !c.Holds(facts) {
+			return false
+		}
+	}
+	return true
+}
+
+func (cs Conditions) String() string {
+	parts := make([]string, len(cs))
+	for i, c := range cs {
+		parts[i] = c.String()
+	}
+	return strings.Join(parts, " && ")
+}
+
+// Within reports whether the conditions hold whenever the other ones do,
+// because each of them is one of the others
+func (cs Conditions) Within(other Conditions) bool {
+	for _, c := range cs {
+		if !slices.Contains(other, c) {
+			return false
+		}
+	}
+	return true
+}
+
+// Excludes reports whether no machine can satisfy both sets of conditions,
+// because they test the same single-valued fact against different values
+func (cs Conditions) Excludes(other Conditions) bool {
+	for _, a := range cs {
+		for _, b := range other {
+			if a.Fact != b.Fact || a.Negated && b.Negated {
+				continue
+			}
+			if a.Negated != b.Negated && a.Value == b.Value {
+				return true
+			}
+			if !a.Negated && !b.Negated && a.Value != b.Value && !multiValuedFact(a.Fact) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// multiValuedFact reports whether a fact can have several values at once
+func multiValuedFact(name string) bool {
+	return name == "gpu.vendor"
+}
+
+// isDirective reports whether the text of a line is an "[if]", "[else]" or "[end]" directive
+func isDirective(text string) bool {
+	return strings.HasPrefix(text, "[")
+}
+
+// parseIf parses an "[if fact == "value"]" line
+func parseIf(text string) (Condition, error) {
+	m := ifDirective.FindStringSubmatch(text)
+	if m == nil {
+		return Condition{}, fmt.Errorf(`invalid condition %q, expected [if fact == "value"]`, text)
+	}
+
+	value, err := strconv.Unquote(m[3])
+	if err != nil {
+		return Condition{}, fmt.Errorf("invalid value in %q: %w", text, err)
+	}
+	cond := Condition{Fact: m[1], Negated: m[2] == "!=", Value: value}
+	if !isFactName(cond.Fact) {
+		return cond, fmt.Errorf("unknown fact %q, expected one of %s", cond.Fact, strings.Join(factNames, ", "))
+	}
+	return cond, nil
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+type noGroups struct{}
+
+func (noGroups) GroupMembers(string) ([]string, error) {
+	return nil, nil
+}
+
+func TestParseIf(t *testing.T) {
+	tests := []struct {
+		text    string
+		want    Condition
+		wantErr bool
+	}{
+		{text: `[if cpu.vendor == "amd"]`, want: Condition{Fact: "cpu.vendor", Value: "amd"}},
+		{text: `[ if  laptop!="true" ]`, want: Condition{Fact: "laptop", Negated: true, Value: "true"}},
+		{text: `[if system.product == "ThinkPad \"X1\" #2"]`, want: Condition{Fact: "system.product", Value: `ThinkPad "X1" #2`}},
+		{text: `[if cpu.vendor = "amd"]`, wantErr: true},
+		{text: `[if cpu.vendor == amd]`, wantErr: true},
+		{text: `[if gpu == "nvidia"]`, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		got, err := parseIf(tt.text)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("parseIf(%s) error = %v, wantErr %v", tt.text, err, tt.wantErr)
+			continue
+		}
+		if !tt.wantErr && got != tt.want {
+			t.Errorf("parseIf(%s) = %+v, want %+v", tt.text, got, tt.want)
+		}
+	}
+}
+
+func TestConditions(t *testing.T) {
+	facts := collectFacts("testdata/facts/thinkpad")
+	amd := Condition{Fact: "cpu.vendor", Value: "amd"}
+	intel := Condition{Fact: "cpu.vendor", Value: "intel"}
+	nvidia := Condition{Fact: "gpu.vendor", Value: "nvidia"}
+	qemu := Condition{Fact: "gpu.vendor", Value: "qemu"}
+
+	if !(Conditions{amd, nvidia}).Holds(facts) {
+		t.Error("amd && nvidia should hold on the thinkpad")
+	}
+	if (Conditions{amd, nvidia.Not()}).Holds(facts) {
+		t.Error("gpu.vendor != nvidia should not hold with one nvidia card out of two")
+	}
+	if !(Conditions{}).Holds(facts) {
+		t.Error("no condition should always hold")
+	}
+
+	if !(Conditions{amd}).Excludes(Conditions{intel}) || !(Conditions{amd}).Excludes(Conditions{amd.Not()}) {
+		t.Error("different values of cpu.vendor should exclude each other")
+	}
+	if (Conditions{nvidia}).Excludes(Conditions{qemu}) {
+		t.Error("gpu.vendor can have several values, its conditions should not exclude each other")
+	}
+	if !(Conditions{amd}).Within(Conditions{amd, nvidia}) || (Conditions{amd, nvidia}).Within(Conditions{amd}) {
+		t.Error("Within should tell the conditions implied by others")
+	}
+
+	if got, want := (Conditions{amd, nvidia.Not()}).String(), `cpu.vendor == "amd" && gpu.vendor != "nvidia"`; got != want {
+		t.Errorf("String() = %s, want %s", got, want)
+	}
+}
+
+// TestEvaluateIfBlocks resolves testdata/packages against the facts of fixture machines
+func TestEvaluateIfBlocks(t *testing.T) {
+	pd := &PackageDef{path: "testdata/packages"}
+	defs, err := pd.LoadAllDefinitions()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name         string
+		facts        Facts
+		wantPackages []string
+		wantExcluded []string
+	}{
+		{
+			name:         "thinkpad",
+			facts:        collectFacts("testdata/facts/thinkpad"),
+			wantPackages: []string{"amd-ucode", "nvidia", "tlp"},
+			wantExcluded: []string{"xf86-video-nouveau"},
+		},
+		{
+			name:         "vm",
+			facts:        collectFacts("testdata/facts/vm"),
+			wantPackages: []string{"intel-ucode", "qemu-guest-agent", "xf86-video-nouveau"},
+		},
+		{
+			// Unknown facts keep every entry, and exclusions are reported
+			// without dropping anything
+			name:         "unknown",
+			wantPackages: []string{"amd-ucode", "intel-ucode", "nvidia", "qemu-guest-agent", "tlp", "xf86-video-nouveau"},
+			wantExcluded: []string{"xf86-video-nouveau"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			machine := Machine{Hostname: tt.name, Facts: tt.facts}
+			desired, excluded, err := buildDesiredPackagesFromDefs(defs, machine, noGroups{})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if got := desiredNames(desired); !reflect.DeepEqual(got, tt.wantPackages) {
+				t.Errorf("packages = %v, want %v", got, tt.wantPackages)
+			}
+			var gotExcluded []string
+			for name := range excluded {
+				gotExcluded = append(gotExcluded, name)
+			}
+			if !reflect.DeepEqual(gotExcluded, tt.wantExcluded) {
+				t.Errorf("excluded = %v, want %v", gotExcluded, tt.wantExcluded)
+			}
+		})
+	}
+}
+
+func TestEvaluateIfBlocksWithUnknownFacts(t *testing.T) {
+	pd := &PackageDef{path: "testdata/packages"}
+	defs, err := pd.LoadAllDefinitions()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	desired, _, err := buildDesiredPackagesFromDefs(defs, Machine{Hostname: "build-01"}, noGroups{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, pkg := range desired {
+		if pkg.Name != "nvidia" {
+			continue
+		}
+		if len(pkg.Sources) != 1 || pkg.Sources[0].When != `gpu.vendor == "nvidia"` {
+			t.Errorf("nvidia sources = %+v, want its condition in When", pkg.Sources)
+		}
+		return
+	}
+	t.Error("nvidia is missing from the packages of a host with unknown facts")
+}
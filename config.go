@@ -10,21 +10,35 @@ import (
 )
 
 type ConfigFile struct {
-	NoConfirm          *bool     `toml:"noConfirm"`
-	AurHelper          *string   `toml:"aurHelper"`
-	ExtraInstallArgs   *[]string `toml:"extraInstallArgs"`
-	ExtraUninstallArgs *[]string `toml:"extraUninstallArgs"`
-	UninstallIgnore    *[]string `toml:"uninstallIgnore"`
-	Pager              *[]string `toml:"pager"`
+	NoConfirm          *bool                `toml:"noConfirm"`
+	AurHelper          *string              `toml:"aurHelper"`
+	ExtraInstallArgs   *[]string            `toml:"extraInstallArgs"`
+	ExtraUninstallArgs *[]string            `toml:"extraUninstallArgs"`
+	UninstallIgnore    *[]string            `toml:"uninstallIgnore"`
+	Pager              *[]string            `toml:"pager"`
+	DBPath             *string              `toml:"dbPath"`
+	CacheDir           *string              `toml:"cacheDir"`
+	AssumeYes          *bool                `toml:"assumeYes"`
+	KnownHosts         *[]string            `toml:"knownHosts"`
+	Roles              *map[string][]string `toml:"roles"`
+	FactsRoot          *string              `toml:"factsRoot"`
+	FactsRoots         *map[string]string   `toml:"factsRoots"`
 }
 
 type Config struct {
-	NoConfirm          bool      `toml:"noConfirm"`
-	AurHelper          string    `toml:"aurHelper"`
-	ExtraInstallArgs   []string  `toml:"extraInstallArgs"`
-	ExtraUninstallArgs []string  `toml:"extraUninstallArgs"`
-	UninstallIgnore    []string  `toml:"uninstallIgnore"`
-	Pager              *[]string `toml:"pager"`
+	NoConfirm          bool                `toml:"noConfirm"`
+	AurHelper          string              `toml:"aurHelper"`
+	ExtraInstallArgs   []string            `toml:"extraInstallArgs"`
+	ExtraUninstallArgs []string            `toml:"extraUninstallArgs"`
+	UninstallIgnore    []string            `toml:"uninstallIgnore"`
+	Pager              *[]string           `toml:"pager"`
+	DBPath             string              `toml:"dbPath"`
+	CacheDir           string              `toml:"cacheDir"`
+	AssumeYes          bool                `toml:"assumeYes"`
+	KnownHosts         []string            `toml:"knownHosts"`
+	Roles              map[string][]string `toml:"roles"`
+	FactsRoot          string              `toml:"factsRoot"`
+	FactsRoots         map[string]string   `toml:"factsRoots"`
 }
 
 const (
@@ -35,6 +49,13 @@ const (
 # extraInstallArgs: additional arguments to pass to install commands
 # extraUninstallArgs: additional arguments to pass to uninstall commands
 # pager: command to use for displaying output with their arguments (e.g. less, bat)
+# dbPath: pacman database directory, read directly instead of querying pacman
+# cacheDir: pacman package cache, used by rollback to reinstall exact versions
+# assumeYes: apply changes without asking for confirmation, like --yes
+# knownHosts: hosts that have never synced yet, so that ditto lint accepts their definitions
+# roles: roles of each host, whose definitions under roles/<role>/ apply to it (e.g. thinkpad = ["laptops"])
+# factsRoot: directory the machine facts of [if] blocks are read from, instead of /proc and /sys of this machine
+# factsRoots: facts directory of other hosts, to evaluate their [if] blocks with --host (e.g. build-01 = "/srv/facts/build-01")
 
 `
 	configPerm = 0644
@@ -44,6 +65,9 @@ var defaultConfig = Config{
 	NoConfirm:       true,
 	AurHelper:       "",
 	UninstallIgnore: nil,
+	DBPath:          "/var/lib/pacman",
+	CacheDir:        "/var/cache/pacman/pkg",
+	FactsRoot:       "/",
 }
 
 func getConfigPath() (string, error) {
@@ -63,6 +87,13 @@ func (cf *ConfigFile) toConfig() *Config {
 		ExtraInstallArgs:   ptrValueOrDefault(cf.ExtraInstallArgs, []string{}),
 		ExtraUninstallArgs: ptrValueOrDefault(cf.ExtraUninstallArgs, []string{}),
 		Pager:              cf.Pager,
+		DBPath:             ptrValueOrDefault(cf.DBPath, defaultConfig.DBPath),
+		CacheDir:           ptrValueOrDefault(cf.CacheDir, defaultConfig.CacheDir),
+		AssumeYes:          ptrValueOrDefault(cf.AssumeYes, defaultConfig.AssumeYes),
+		KnownHosts:         ptrValueOrDefault(cf.KnownHosts, defaultConfig.KnownHosts),
+		Roles:              ptrValueOrDefault(cf.Roles, defaultConfig.Roles),
+		FactsRoot:          ptrValueOrDefault(cf.FactsRoot, defaultConfig.FactsRoot),
+		FactsRoots:         ptrValueOrDefault(cf.FactsRoots, defaultConfig.FactsRoots),
 	}
 }
 
@@ -6,10 +6,38 @@ package database
 
 import (
 	"database/sql"
+	"time"
 )
 
+type HostProfile struct {
+	Host    string
+	Profile string
+}
+
 type Package struct {
-	ID   int64
-	Host sql.NullString
-	Name string
+	ID    int64
+	Host  string
+	Scope string
+	Name  string
+}
+
+type Transaction struct {
+	ID          int64
+	StartedAt   time.Time
+	DurationMs  int64
+	Host        string
+	Flags       string
+	InstallArgs string
+	RemoveArgs  string
+	Status      string
+	Error       sql.NullString
+}
+
+type TransactionChange struct {
+	ID            int64
+	TransactionID int64
+	Action        string
+	Package       string
+	Status        string
+	Version       sql.NullString
 }
@@ -8,70 +8,125 @@ package database
 import (
 	"context"
 	"database/sql"
+	"time"
 )
 
 const createPackage = `-- name: CreatePackage :one
 INSERT INTO
-    packages (name, host)
+    packages (host, scope, name)
 VALUES
-    (?, ?)
+    (?, ?, ?)
 RETURNING
     id,
-    name,
-    host
+    host,
+    scope,
+    name
 `
 
 type CreatePackageParams struct {
-	Name string
-	Host sql.NullString
-}
-
-type CreatePackageRow struct {
-	ID   int64
-	Name string
-	Host sql.NullString
+	Host  string
+	Scope string
+	Name  string
 }
 
-func (q *Queries) CreatePackage(ctx context.Context, arg CreatePackageParams) (CreatePackageRow, error) {
-	row := q.db.QueryRowContext(ctx, createPackage, arg.Name, arg.Host)
-	var i CreatePackageRow
-	err := row.Scan(&i.ID, &i.Name, &i.Host)
+func (q *Queries) CreatePackage(ctx context.Context, arg CreatePackageParams) (Package, error) {
+	row := q.db.QueryRowContext(ctx, createPackage, arg.Host, arg.Scope, arg.Name)
+	var i Package
+	err := row.Scan(
+		&i.ID,
+		&i.Host,
+		&i.Scope,
+		&i.Name,
+	)
 	return i, err
 }
 
-const createPackageWithoutHost = `-- name: CreatePackageWithoutHost :one
+const createTransaction = `-- name: CreateTransaction :one
 INSERT INTO
-    packages (name)
+    transactions (
+        started_at,
+        duration_ms,
+        host,
+        flags,
+        install_args,
+        remove_args,
+        status,
+        error
+    )
 VALUES
-    (?)
+    (?, ?, ?, ?, ?, ?, ?, ?)
 RETURNING
     id,
-    name,
-    host
+    started_at,
+    duration_ms,
+    host,
+    flags,
+    install_args,
+    remove_args,
+    status,
+    error
 `
 
-type CreatePackageWithoutHostRow struct {
-	ID   int64
-	Name string
-	Host sql.NullString
+type CreateTransactionParams struct {
+	StartedAt   time.Time
+	DurationMs  int64
+	Host        string
+	Flags       string
+	InstallArgs string
+	RemoveArgs  string
+	Status      string
+	Error       sql.NullString
 }
 
-func (q *Queries) CreatePackageWithoutHost(ctx context.Context, name string) (CreatePackageWithoutHostRow, error) {
-	row := q.db.QueryRowContext(ctx, createPackageWithoutHost, name)
-	var i CreatePackageWithoutHostRow
-	err := row.Scan(&i.ID, &i.Name, &i.Host)
+func (q *Queries) CreateTransaction(ctx context.Context, arg CreateTransactionParams) (Transaction, error) {
+	row := q.db.QueryRowContext(ctx, createTransaction,
+		arg.StartedAt,
+		arg.DurationMs,
+		arg.Host,
+		arg.Flags,
+		arg.InstallArgs,
+		arg.RemoveArgs,
+		arg.Status,
+		arg.Error,
+	)
+	var i Transaction
+	err := row.Scan(
+		&i.ID,
+		&i.StartedAt,
+		&i.DurationMs,
+		&i.Host,
+		&i.Flags,
+		&i.InstallArgs,
+		&i.RemoveArgs,
+		&i.Status,
+		&i.Error,
+	)
 	return i, err
 }
 
-const deletePackage = `-- name: DeletePackage :exec
-DELETE FROM
-    packages
-WHERE
-    name = ?
+const createTransactionChange = `-- name: CreateTransactionChange :exec
+INSERT INTO
+    transaction_changes (transaction_id, action, package, status, version)
+VALUES
+    (?, ?, ?, ?, ?)
 `
 
-func (q *Queries) DeletePackage(ctx context.Context, name string) error {
-	_, err := q.db.ExecContext(ctx, deletePackage, name)
+type CreateTransactionChangeParams struct {
+	TransactionID int64
+	Action        string
+	Package       string
+	Status        string
+	Version       sql.NullString
+}
+
+func (q *Queries) CreateTransactionChange(ctx context.Context, arg CreateTransactionChangeParams) error {
+	_, err := q.db.ExecContext(ctx, createTransactionChange,
+		arg.TransactionID,
+		arg.Action,
+		arg.Package,
+		arg.Status,
+		arg.Version,
+	)
 	return err
 }
 
@@ -80,23 +135,16 @@ DELETE FROM
     packages
 WHERE
     name = ?
-    AND (
-        host = ?
-        OR (
-            host IS NULL
-            AND ? IS NULL
-        )
-    )
+    AND host = ?
 `
 
 type DeletePackageByNameAndHostParams struct {
-	Name    string
-	Host    sql.NullString
-	Column3 interface{}
+	Name string
+	Host string
 }
 
 func (q *Queries) DeletePackageByNameAndHost(ctx context.Context, arg DeletePackageByNameAndHostParams) error {
-	_, err := q.db.ExecContext(ctx, deletePackageByNameAndHost, arg.Name, arg.Host, arg.Column3)
+	_, err := q.db.ExecContext(ctx, deletePackageByNameAndHost, arg.Name, arg.Host)
 	return err
 }
 
@@ -104,113 +152,153 @@ const deletePackagesByHost = `-- name: DeletePackagesByHost :exec
 DELETE FROM
     packages
 WHERE
-    (
-        host = ?
-        OR (
-            host IS NULL
-            AND ? IS NULL
-        )
-    )
+    host = ?
+`
+
+func (q *Queries) DeletePackagesByHost(ctx context.Context, host string) error {
+	_, err := q.db.ExecContext(ctx, deletePackagesByHost, host)
+	return err
+}
+
+const disableHostProfile = `-- name: DisableHostProfile :exec
+DELETE FROM
+    host_profiles
+WHERE
+    host = ?
+    AND profile = ?
+`
+
+type DisableHostProfileParams struct {
+	Host    string
+	Profile string
+}
+
+func (q *Queries) DisableHostProfile(ctx context.Context, arg DisableHostProfileParams) error {
+	_, err := q.db.ExecContext(ctx, disableHostProfile, arg.Host, arg.Profile)
+	return err
+}
+
+const enableHostProfile = `-- name: EnableHostProfile :exec
+INSERT INTO
+    host_profiles (host, profile)
+VALUES
+    (?, ?) ON CONFLICT (host, profile) DO NOTHING
 `
 
-type DeletePackagesByHostParams struct {
-	Host    sql.NullString
-	Column2 interface{}
+type EnableHostProfileParams struct {
+	Host    string
+	Profile string
 }
 
-func (q *Queries) DeletePackagesByHost(ctx context.Context, arg DeletePackagesByHostParams) error {
-	_, err := q.db.ExecContext(ctx, deletePackagesByHost, arg.Host, arg.Column2)
+func (q *Queries) EnableHostProfile(ctx context.Context, arg EnableHostProfileParams) error {
+	_, err := q.db.ExecContext(ctx, enableHostProfile, arg.Host, arg.Profile)
 	return err
 }
 
-const getPackageByName = `-- name: GetPackageByName :one
+const getLatestRollbackableTransaction = `-- name: GetLatestRollbackableTransaction :one
 SELECT
     id,
-    name,
-    host
+    started_at,
+    duration_ms,
+    host,
+    flags,
+    install_args,
+    remove_args,
+    status,
+    error
 FROM
-    packages
+    transactions t
 WHERE
-    name = ?
+    host = ?
+    AND EXISTS (
+        SELECT
+            1
+        FROM
+            transaction_changes c
+        WHERE
+            c.transaction_id = t.id
+            AND c.status = 'succeeded'
+    )
+ORDER BY
+    id DESC
+LIMIT
+    1
 `
 
-type GetPackageByNameRow struct {
-	ID   int64
-	Name string
-	Host sql.NullString
-}
-
-func (q *Queries) GetPackageByName(ctx context.Context, name string) (GetPackageByNameRow, error) {
-	row := q.db.QueryRowContext(ctx, getPackageByName, name)
-	var i GetPackageByNameRow
-	err := row.Scan(&i.ID, &i.Name, &i.Host)
+func (q *Queries) GetLatestRollbackableTransaction(ctx context.Context, host string) (Transaction, error) {
+	row := q.db.QueryRowContext(ctx, getLatestRollbackableTransaction, host)
+	var i Transaction
+	err := row.Scan(
+		&i.ID,
+		&i.StartedAt,
+		&i.DurationMs,
+		&i.Host,
+		&i.Flags,
+		&i.InstallArgs,
+		&i.RemoveArgs,
+		&i.Status,
+		&i.Error,
+	)
 	return i, err
 }
 
 const getPackageByNameAndHost = `-- name: GetPackageByNameAndHost :one
 SELECT
     id,
-    name,
-    host
+    host,
+    scope,
+    name
 FROM
     packages
 WHERE
     name = ?
-    AND (
-        host = ?
-        OR (
-            host IS NULL
-            AND ? IS NULL
-        )
-    )
+    AND host = ?
 `
 
 type GetPackageByNameAndHostParams struct {
-	Name    string
-	Host    sql.NullString
-	Column3 interface{}
-}
-
-type GetPackageByNameAndHostRow struct {
-	ID   int64
 	Name string
-	Host sql.NullString
+	Host string
 }
 
-func (q *Queries) GetPackageByNameAndHost(ctx context.Context, arg GetPackageByNameAndHostParams) (GetPackageByNameAndHostRow, error) {
-	row := q.db.QueryRowContext(ctx, getPackageByNameAndHost, arg.Name, arg.Host, arg.Column3)
-	var i GetPackageByNameAndHostRow
-	err := row.Scan(&i.ID, &i.Name, &i.Host)
+func (q *Queries) GetPackageByNameAndHost(ctx context.Context, arg GetPackageByNameAndHostParams) (Package, error) {
+	row := q.db.QueryRowContext(ctx, getPackageByNameAndHost, arg.Name, arg.Host)
+	var i Package
+	err := row.Scan(
+		&i.ID,
+		&i.Host,
+		&i.Scope,
+		&i.Name,
+	)
 	return i, err
 }
 
 const getPackages = `-- name: GetPackages :many
 SELECT
     id,
-    name,
-    host
+    host,
+    scope,
+    name
 FROM
     packages
 ORDER BY
     name
 `
 
-type GetPackagesRow struct {
-	ID   int64
-	Name string
-	Host sql.NullString
-}
-
-func (q *Queries) GetPackages(ctx context.Context) ([]GetPackagesRow, error) {
+func (q *Queries) GetPackages(ctx context.Context) ([]Package, error) {
 	rows, err := q.db.QueryContext(ctx, getPackages)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
-	var items []GetPackagesRow
+	var items []Package
 	for rows.Next() {
-		var i GetPackagesRow
-		if err := rows.Scan(&i.ID, &i.Name, &i.Host); err != nil {
+		var i Package
+		if err := rows.Scan(
+			&i.ID,
+			&i.Host,
+			&i.Scope,
+			&i.Name,
+		); err != nil {
 			return nil, err
 		}
 		items = append(items, i)
@@ -227,41 +315,112 @@ func (q *Queries) GetPackages(ctx context.Context) ([]GetPackagesRow, error) {
 const getPackagesByHost = `-- name: GetPackagesByHost :many
 SELECT
     id,
-    name,
-    host
+    host,
+    scope,
+    name
 FROM
     packages
 WHERE
-    (
-        host = ?
-        OR (
-            host IS NULL
-            AND ? IS NULL
-        )
-    )
+    host = ?
+ORDER BY
+    name
 `
 
-type GetPackagesByHostParams struct {
-	Host    sql.NullString
-	Column2 interface{}
+func (q *Queries) GetPackagesByHost(ctx context.Context, host string) ([]Package, error) {
+	rows, err := q.db.QueryContext(ctx, getPackagesByHost, host)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Package
+	for rows.Next() {
+		var i Package
+		if err := rows.Scan(
+			&i.ID,
+			&i.Host,
+			&i.Scope,
+			&i.Name,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
 }
 
-type GetPackagesByHostRow struct {
-	ID   int64
-	Name string
-	Host sql.NullString
+const getTransaction = `-- name: GetTransaction :one
+SELECT
+    id,
+    started_at,
+    duration_ms,
+    host,
+    flags,
+    install_args,
+    remove_args,
+    status,
+    error
+FROM
+    transactions
+WHERE
+    id = ?
+`
+
+func (q *Queries) GetTransaction(ctx context.Context, id int64) (Transaction, error) {
+	row := q.db.QueryRowContext(ctx, getTransaction, id)
+	var i Transaction
+	err := row.Scan(
+		&i.ID,
+		&i.StartedAt,
+		&i.DurationMs,
+		&i.Host,
+		&i.Flags,
+		&i.InstallArgs,
+		&i.RemoveArgs,
+		&i.Status,
+		&i.Error,
+	)
+	return i, err
 }
 
-func (q *Queries) GetPackagesByHost(ctx context.Context, arg GetPackagesByHostParams) ([]GetPackagesByHostRow, error) {
-	rows, err := q.db.QueryContext(ctx, getPackagesByHost, arg.Host, arg.Column2)
+const getTransactionChanges = `-- name: GetTransactionChanges :many
+SELECT
+    id,
+    transaction_id,
+    action,
+    package,
+    status,
+    version
+FROM
+    transaction_changes
+WHERE
+    transaction_id = ?
+ORDER BY
+    id
+`
+
+func (q *Queries) GetTransactionChanges(ctx context.Context, transactionID int64) ([]TransactionChange, error) {
+	rows, err := q.db.QueryContext(ctx, getTransactionChanges, transactionID)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
-	var items []GetPackagesByHostRow
+	var items []TransactionChange
 	for rows.Next() {
-		var i GetPackagesByHostRow
-		if err := rows.Scan(&i.ID, &i.Name, &i.Host); err != nil {
+		var i TransactionChange
+		if err := rows.Scan(
+			&i.ID,
+			&i.TransactionID,
+			&i.Action,
+			&i.Package,
+			&i.Status,
+			&i.Version,
+		); err != nil {
 			return nil, err
 		}
 		items = append(items, i)
@@ -275,62 +434,169 @@ func (q *Queries) GetPackagesByHost(ctx context.Context, arg GetPackagesByHostPa
 	return items, nil
 }
 
-const upsertPackage = `-- name: UpsertPackage :one
-INSERT INTO
-    packages (name, host)
-VALUES
-    (?, ?) ON CONFLICT (name, host) DO
-UPDATE
-SET
-    name = EXCLUDED.name,
-    host = EXCLUDED.host
-RETURNING
-    id,
-    name,
+const listHostProfiles = `-- name: ListHostProfiles :many
+SELECT
+    profile
+FROM
+    host_profiles
+WHERE
+    host = ?
+ORDER BY
+    profile
+`
+
+func (q *Queries) ListHostProfiles(ctx context.Context, host string) ([]string, error) {
+	rows, err := q.db.QueryContext(ctx, listHostProfiles, host)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []string
+	for rows.Next() {
+		var profile string
+		if err := rows.Scan(&profile); err != nil {
+			return nil, err
+		}
+		items = append(items, profile)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listKnownHosts = `-- name: ListKnownHosts :many
+SELECT
+    host
+FROM
+    packages
+WHERE
+    host != ''
+UNION
+SELECT
+    host
+FROM
+    transactions
+ORDER BY
     host
 `
 
-type UpsertPackageParams struct {
-	Name string
-	Host sql.NullString
+func (q *Queries) ListKnownHosts(ctx context.Context) ([]string, error) {
+	rows, err := q.db.QueryContext(ctx, listKnownHosts)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []string
+	for rows.Next() {
+		var host string
+		if err := rows.Scan(&host); err != nil {
+			return nil, err
+		}
+		items = append(items, host)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
 }
 
-type UpsertPackageRow struct {
-	ID   int64
-	Name string
-	Host sql.NullString
+const listTransactions = `-- name: ListTransactions :many
+SELECT
+    t.id,
+    t.started_at,
+    t.duration_ms,
+    t.host,
+    t.flags,
+    t.status,
+    COUNT(c.id) AS change_count
+FROM
+    transactions t
+    LEFT JOIN transaction_changes c ON c.transaction_id = t.id
+GROUP BY
+    t.id
+ORDER BY
+    t.id DESC
+LIMIT
+    ?
+`
+
+type ListTransactionsRow struct {
+	ID          int64
+	StartedAt   time.Time
+	DurationMs  int64
+	Host        string
+	Flags       string
+	Status      string
+	ChangeCount int64
 }
 
-func (q *Queries) UpsertPackage(ctx context.Context, arg UpsertPackageParams) (UpsertPackageRow, error) {
-	row := q.db.QueryRowContext(ctx, upsertPackage, arg.Name, arg.Host)
-	var i UpsertPackageRow
-	err := row.Scan(&i.ID, &i.Name, &i.Host)
-	return i, err
+func (q *Queries) ListTransactions(ctx context.Context, limit int64) ([]ListTransactionsRow, error) {
+	rows, err := q.db.QueryContext(ctx, listTransactions, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []ListTransactionsRow
+	for rows.Next() {
+		var i ListTransactionsRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.StartedAt,
+			&i.DurationMs,
+			&i.Host,
+			&i.Flags,
+			&i.Status,
+			&i.ChangeCount,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
 }
 
-const upsertPackageWithoutHost = `-- name: UpsertPackageWithoutHost :one
+const upsertPackage = `-- name: UpsertPackage :one
 INSERT INTO
-    packages (name)
+    packages (host, scope, name)
 VALUES
-    (?) ON CONFLICT (name) DO
+    (?, ?, ?) ON CONFLICT (host, scope, name) DO
 UPDATE
 SET
     name = EXCLUDED.name
 RETURNING
     id,
-    name,
-    host
+    host,
+    scope,
+    name
 `
 
-type UpsertPackageWithoutHostRow struct {
-	ID   int64
-	Name string
-	Host sql.NullString
+type UpsertPackageParams struct {
+	Host  string
+	Scope string
+	Name  string
 }
 
-func (q *Queries) UpsertPackageWithoutHost(ctx context.Context, name string) (UpsertPackageWithoutHostRow, error) {
-	row := q.db.QueryRowContext(ctx, upsertPackageWithoutHost, name)
-	var i UpsertPackageWithoutHostRow
-	err := row.Scan(&i.ID, &i.Name, &i.Host)
+func (q *Queries) UpsertPackage(ctx context.Context, arg UpsertPackageParams) (Package, error) {
+	row := q.db.QueryRowContext(ctx, upsertPackage, arg.Host, arg.Scope, arg.Name)
+	var i Package
+	err := row.Scan(
+		&i.ID,
+		&i.Host,
+		&i.Scope,
+		&i.Name,
+	)
 	return i, err
 }
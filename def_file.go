@@ -0,0 +1,254 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// validName is what makepkg accepts as a package name, also used for groups
+var validName = regexp.MustCompile(`^[A-Za-z0-9@_+][A-Za-z0-9@._+-]*$`)
+
+// LineKind is what a line of a definition file declares
+type LineKind int
+
+const (
+	LineBlank LineKind = iota
+	LineComment
+	LinePackage
+	LineGroup
+	// LineExclude is a "!pkg" line, removing a package from the host's set
+	LineExclude
+	// LineInvalid is a line that could not be parsed, kept as is
+	LineInvalid
+	// LineIf, LineElse and LineEnd delimit lines that only apply when a fact of the machine has a value
+	LineIf
+	LineElse
+	LineEnd
+)
+
+// DefLine is a line of a definition file. Raw is kept verbatim so that
+// unchanged lines are written back exactly as they were read.
+type DefLine struct {
+	Raw  string
+	Kind LineKind
+	// Name is the declared package for package lines, the excluded one for exclusion lines
+	Name string
+	// Group is the declared group, for group lines
+	Group GroupEntry
+	// Comment is the text after "#", for comment lines and inline comments
+	Comment string
+	// Cond is the tested condition, for "[if]" lines
+	Cond Condition
+	// When are the conditions of the blocks enclosing the line
+	When Conditions
+}
+
+// DefFile is a definition file parsed without losing anything: comments,
+// blank lines and ordering survive an edit
+type DefFile struct {
+	Lines []DefLine
+	// TrailingNewline is set when the file ends with a newline
+	TrailingNewline bool
+}
+
+// ParseError is an invalid line of a definition file
+type ParseError struct {
+	File string
+	Line int
+	Err  error
+}
+
+func (e *ParseError) Error() string {
+	return fmt.Sprintf("%s:%d: %v", e.File, e.Line, e.Err)
+}
+
+func (e *ParseError) Unwrap() error {
+	return e.Err
+}
+
+// parseDefContent parses the content of a definition file, name is used in
+// errors. Every invalid line is reported, and kept in the returned file.
+func parseDefContent(name string, data []byte) (*DefFile, error) {
+	df := &DefFile{}
+	content := string(data)
+	if content == "" {
+		return df, nil
+	}
+
+	rawLines := strings.Split(content, "\n")
+	if rawLines[len(rawLines)-1] == "" {
+		df.TrailingNewline = true
+		rawLines = rawLines[:len(rawLines)-1]
+	}
+
+	// block is an "[if]" being parsed, with the line it starts on
+	type block struct {
+		cond   Condition
+		line   int
+		inElse bool
+	}
+	var blocks []block
+	enclosing := func() Conditions {
+		var when Conditions
+		for _, b := range blocks {
+			if b.inElse {
+				when = append(when, b.cond.Not())
+			} else {
+				when = append(when, b.cond)
+			}
+		}
+		return when
+	}
+
+	var errs []error
+	for i, raw := range rawLines {
+		text, comment := parseLine(raw)
+		line := DefLine{Raw: raw, Comment: comment, When: enclosing()}
+		switch {
+		case text == DIRECTIVE_ELSE:
+			if len(blocks) == 0 || blocks[len(blocks)-1].inElse {
+				errs = append(errs, &ParseError{File: name, Line: i + 1, Err: errors.New("[else] without a matching [if]")})
+				line.Kind = LineInvalid
+				break
+			}
+			blocks[len(blocks)-1].inElse = true
+			line.Kind = LineElse
+			line.When = line.When[:len(line.When)-1]
+		case text == DIRECTIVE_END:
+			if len(blocks) == 0 {
+				errs = append(errs, &ParseError{File: name, Line: i + 1, Err: errors.New("[end] without a matching [if]")})
+				line.Kind = LineInvalid
+				break
+			}
+			blocks = blocks[:len(blocks)-1]
+			line.Kind = LineEnd
+			line.When = line.When[:len(line.When)-1]
+		case isDirective(text):
+			cond, err := parseIf(text)
+			// The block is opened even when invalid, so that its [end] still matches
+			blocks = append(blocks, block{cond: cond, line: i + 1})
+			if err != nil {
+				errs = append(errs, &ParseError{File: name, Line: i + 1, Err: err})
+				line.Kind = LineInvalid
+				break
+			}
+			line.Kind = LineIf
+			line.Cond = cond
+		case text == "" && strings.TrimSpace(raw) == "":
+			line.Kind = LineBlank
+		case text == "":
+			line.Kind = LineComment
+		case strings.HasPrefix(text, GROUP_PREFIX):
+			group, err := parseGroup(text)
+			if err != nil {
+				errs = append(errs, &ParseError{File: name, Line: i + 1, Err: err})
+				line.Kind = LineInvalid
+				break
+			}
+			line.Kind = LineGroup
+			line.Group = group
+		case strings.HasPrefix(text, EXCLUDE_PREFIX):
+			excluded := strings.TrimSpace(strings.TrimPrefix(text, EXCLUDE_PREFIX))
+			if excluded == "" || strings.ContainsAny(excluded, " \t") {
+				errs = append(errs, &ParseError{File: name, Line: i + 1, Err: fmt.Errorf("invalid exclusion %q", text)})
+				line.Kind = LineInvalid
+				break
+			}
+			line.Kind = LineExclude
+			line.Name = excluded
+		default:
+			line.Kind = LinePackage
+			line.Name = text
+		}
+		df.Lines = append(df.Lines, line)
+	}
+	for _, b := range blocks {
+		errs = append(errs, &ParseError{File: name, Line: b.line, Err: errors.New("[if] without a matching [end]")})
+	}
+
+	return df, errors.Join(errs...)
+}
+
+// Bytes renders the file back
+func (df *DefFile) Bytes() []byte {
+	raws := make([]string, len(df.Lines))
+	for i, line := range df.Lines {
+		raws[i] = line.Raw
+	}
+
+	content := strings.Join(raws, "\n")
+	if df.TrailingNewline {
+		content += "\n"
+	}
+	return []byte(content)
+}
+
+// Description returns the comment block at the top of the file, joined on a single line
+func (df *DefFile) Description() string {
+	var parts []string
+	for _, line := range df.Lines {
+		if line.Kind != LineComment {
+			break
+		}
+		if line.Comment != "" {
+			parts = append(parts, line.Comment)
+		}
+	}
+	return strings.Join(parts, " ")
+}
+
+// Packages returns the packages declared in the file, with their line number
+func (df *DefFile) Packages() []PackageEntry {
+	var pkgs []PackageEntry
+	for i, line := range df.Lines {
+		if line.Kind == LinePackage {
+			pkgs = append(pkgs, PackageEntry{Name: line.Name, Line: i + 1, Comment: line.Comment, When: line.When})
+		}
+	}
+	return pkgs
+}
+
+// Excludes returns the packages excluded with "!pkg" lines, with their line number
+func (df *DefFile) Excludes() []PackageEntry {
+	var pkgs []PackageEntry
+	for i, line := range df.Lines {
+		if line.Kind == LineExclude {
+			pkgs = append(pkgs, PackageEntry{Name: line.Name, Line: i + 1, Comment: line.Comment, When: line.When})
+		}
+	}
+	return pkgs
+}
+
+// Groups returns the groups declared in the file
+func (df *DefFile) Groups() []GroupEntry {
+	var groups []GroupEntry
+	for i, line := range df.Lines {
+		if line.Kind == LineGroup {
+			group := line.Group
+			group.Line = i + 1
+			group.Comment = line.Comment
+			group.When = line.When
+			groups = append(groups, group)
+		}
+	}
+	return groups
+}
+
+// Append adds a package line at the end of the file and returns its line number
+func (df *DefFile) Append(name string) int {
+	df.Lines = append(df.Lines, DefLine{Raw: name, Kind: LinePackage, Name: name})
+	df.TrailingNewline = true
+	return len(df.Lines)
+}
+
+// Remove deletes every line declaring the package and reports whether there was any
+func (df *DefFile) Remove(name string) bool {
+	count := len(df.Lines)
+	df.Lines = slices.DeleteFunc(df.Lines, func(line DefLine) bool {
+		return line.Kind == LinePackage && line.Name == name
+	})
+	return len(df.Lines) != count
+}
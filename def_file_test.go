@@ -0,0 +1,139 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"reflect"
+	"testing"
+)
+
+func readDefFixture(t *testing.T, name string) []byte {
+	t.Helper()
+	data, err := os.ReadFile("testdata/defs/" + name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func TestParseDefContentRoundTrip(t *testing.T) {
+	for _, content := range []string{
+		string(readDefFixture(t, "laptop.pkgs")),
+		"",
+		"no-newline",
+		"\n\n",
+		"  spaced  # kept as is  \r\n",
+	} {
+		df, err := parseDefContent("test.pkgs", []byte(content))
+		if err != nil {
+			t.Fatalf("parseDefContent(%q) error: %v", content, err)
+		}
+		if got := string(df.Bytes()); got != content {
+			t.Errorf("Bytes() = %q, want %q", got, content)
+		}
+	}
+}
+
+func TestParseDefContent(t *testing.T) {
+	df, err := parseDefContent("laptop.pkgs", readDefFixture(t, "laptop.pkgs"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	kinds := make([]LineKind, len(df.Lines))
+	for i, line := range df.Lines {
+		kinds[i] = line.Kind
+	}
+	wantKinds := []LineKind{
+		LineComment, LineComment, LineBlank,
+		LineGroup, LineExclude, LinePackage, LineBlank,
+		LineIf, LinePackage, LineElse, LinePackage, LineIf, LinePackage, LineEnd, LineEnd,
+		LinePackage,
+	}
+	if !reflect.DeepEqual(kinds, wantKinds) {
+		t.Fatalf("line kinds = %v, want %v", kinds, wantKinds)
+	}
+
+	if got, want := df.Description(), "Laptop setup power and graphics"; got != want {
+		t.Errorf("Description() = %q, want %q", got, want)
+	}
+
+	amd := Condition{Fact: "cpu.vendor", Value: "amd"}
+	thinkpad := Condition{Fact: "system.product", Value: "ThinkPad #1"}
+	wantPackages := []PackageEntry{
+		{Name: "tlp", Line: 6, Comment: "battery life"},
+		{Name: "amd-ucode", Line: 9, When: Conditions{amd}},
+		{Name: "intel-ucode", Line: 11, When: Conditions{amd.Not()}},
+		{Name: "thinkfan", Line: 13, When: Conditions{amd.Not(), thinkpad}},
+		{Name: "steam", Line: 16},
+	}
+	if got := df.Packages(); !reflect.DeepEqual(got, wantPackages) {
+		t.Errorf("Packages() = %+v, want %+v", got, wantPackages)
+	}
+
+	wantGroups := []GroupEntry{{Name: "gnome", Exclude: []string{"gnome-maps", "epiphany"}, Line: 4, Comment: "desktop"}}
+	if got := df.Groups(); !reflect.DeepEqual(got, wantGroups) {
+		t.Errorf("Groups() = %+v, want %+v", got, wantGroups)
+	}
+
+	wantExcludes := []PackageEntry{{Name: "nvidia", Line: 5}}
+	if got := df.Excludes(); !reflect.DeepEqual(got, wantExcludes) {
+		t.Errorf("Excludes() = %+v, want %+v", got, wantExcludes)
+	}
+
+	if cond := df.Lines[11].Cond; cond != thinkpad {
+		t.Errorf("Cond of line 12 = %+v, want %+v", cond, thinkpad)
+	}
+	if when := df.Lines[13].When; !reflect.DeepEqual(when, Conditions{amd.Not()}) {
+		t.Errorf("When of the inner [end] = %v, want the outer [else] only", when)
+	}
+}
+
+func TestParseDefContentErrors(t *testing.T) {
+	content := readDefFixture(t, "invalid.pkgs")
+	df, err := parseDefContent("invalid.pkgs", content)
+	if err == nil {
+		t.Fatal("parseDefContent() succeeded on invalid content")
+	}
+
+	var lines []int
+	for _, e := range err.(interface{ Unwrap() []error }).Unwrap() {
+		var parseErr *ParseError
+		if !errors.As(e, &parseErr) || parseErr.File != "invalid.pkgs" {
+			t.Fatalf("error %v is not a ParseError of invalid.pkgs", e)
+		}
+		lines = append(lines, parseErr.Line)
+	}
+	if want := []int{1, 2, 3, 6, 8, 9}; !reflect.DeepEqual(lines, want) {
+		t.Errorf("errors on lines %v, want %v", lines, want)
+	}
+
+	// Invalid lines are kept, so the file is still written back as is
+	if got := string(df.Bytes()); got != string(content) {
+		t.Errorf("Bytes() = %q, want %q", got, content)
+	}
+	if df.Lines[0].Kind != LineInvalid || df.Lines[3].Kind != LinePackage {
+		t.Errorf("line kinds = %v and %v, want LineInvalid and LinePackage", df.Lines[0].Kind, df.Lines[3].Kind)
+	}
+}
+
+func TestDefFileAppendAndRemove(t *testing.T) {
+	df, err := parseDefContent("dev.pkgs", []byte("# tools\nneovim # editor\nripgrep\nneovim"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if line := df.Append("fd"); line != 5 {
+		t.Errorf("Append() = %d, want 5", line)
+	}
+	if !df.Remove("neovim") {
+		t.Error("Remove(neovim) = false, want true")
+	}
+	if df.Remove("missing") {
+		t.Error("Remove(missing) = true, want false")
+	}
+
+	if got, want := string(df.Bytes()), "# tools\nripgrep\nfd\n"; got != want {
+		t.Errorf("Bytes() = %q, want %q", got, want)
+	}
+}
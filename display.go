@@ -5,30 +5,61 @@ import (
 	"fmt"
 	"os"
 	"os/exec"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/charmbracelet/lipgloss"
 	"github.com/charmbracelet/lipgloss/table"
+	"github.com/ony-boom/ditto/database"
 )
 
-func buildDiffTable(diff PackageDiff, strict bool) *table.Table {
+// ChangeRow is a line of the changes table
+type ChangeRow struct {
+	Action  ChangeAction
+	Package string
+	Reason  string
+}
+
+// diffRows lists the changes of a diff, in the order they are applied, with their reason
+func diffRows(diff PackageDiff, strict bool) []ChangeRow {
+	var rows []ChangeRow
+
+	// To Install
+	for _, pkg := range diff.ToAdd {
+		rows = append(rows, ChangeRow{ActionInstall, pkg, describeDesired("Missing from system", diff.Desired[pkg])})
+	}
+
+	// Strict reason changes
+	if strict {
+		for _, pkg := range diff.ToMarkExplicit {
+			rows = append(rows, ChangeRow{ActionMarkExplicit, pkg, describeDesired("Listed but installed as a dependency", diff.Desired[pkg])})
+		}
+		for _, pkg := range diff.ToRemove {
+			rows = append(rows, ChangeRow{ActionDemote, pkg, describeExcluded("Unlisted explicit package (strict mode)", diff, pkg)})
+		}
+	}
+
+	// Ditto-managed removals
+	for _, pkg := range diff.ToRemoveFromDitto {
+		rows = append(rows, ChangeRow{ActionRemoveUnmanaged, pkg, describeExcluded("No longer managed by Ditto", diff, pkg)})
+	}
+
+	return rows
+}
+
+func buildChangesTable(rows []ChangeRow) *table.Table {
 	white := lipgloss.Color("15")
-	green := lipgloss.Color("10")
-	red := lipgloss.Color("9")
 
 	headerStyle := lipgloss.NewStyle().
 		Foreground(white).
 		Padding(0, 1).
 		Bold(true)
 
-	actionInstall := lipgloss.NewStyle().
-		Foreground(green).
+	actionStyle := lipgloss.NewStyle().
 		Padding(0, 1).
-		Width(10)
-
-	actionRemove := lipgloss.NewStyle().
-		Foreground(red).
-		Padding(0, 1).
-		Width(10)
+		Width(12)
 
 	packageStyle := lipgloss.NewStyle().
 		Foreground(white).
@@ -48,8 +79,9 @@ func buildDiffTable(diff PackageDiff, strict bool) *table.Table {
 				return headerStyle
 			}
 			switch col {
-			case 0: // Action column
-				return lipgloss.NewStyle().Padding(0, 1).Width(10)
+			case 0:
+				_, color := actionLabel(rows[row].Action)
+				return actionStyle.Foreground(color)
 			case 1:
 				return packageStyle
 			case 2:
@@ -59,38 +91,245 @@ func buildDiffTable(diff PackageDiff, strict bool) *table.Table {
 			}
 		})
 
-	// To Install
-	for _, pkg := range diff.ToAdd {
+	for _, row := range rows {
+		label, _ := actionLabel(row.Action)
+		t.Row(label, row.Package, row.Reason)
+	}
+
+	return t
+}
+
+// actionLabel is how an action is shown in tables, with its color
+func actionLabel(action ChangeAction) (string, lipgloss.Color) {
+	switch action {
+	case ActionInstall:
+		return "INSTALL", lipgloss.Color("10")
+	case ActionMarkExplicit:
+		return "EXPLICIT", lipgloss.Color("11")
+	case ActionDemote:
+		return "DEMOTE", lipgloss.Color("9")
+	default:
+		return "REMOVE", lipgloss.Color("9")
+	}
+}
+
+// buildHistoryTable lists recorded syncs
+func buildHistoryTable(rows []database.ListTransactionsRow) *table.Table {
+	t := table.New().
+		Border(lipgloss.NormalBorder()).
+		Headers("ID", "Date", "Host", "Flags", "Status", "Changes", "Duration").
+		StyleFunc(func(row, col int) lipgloss.Style {
+			style := lipgloss.NewStyle().Padding(0, 1)
+			if row == table.HeaderRow {
+				return style.Bold(true)
+			}
+			if col == 4 {
+				return style.Foreground(transactionStatusColor(rows[row].Status))
+			}
+			return style
+		})
+
+	for _, r := range rows {
 		t.Row(
-			actionInstall.Render("INSTALL"),
-			pkg,
-			"Missing from system",
+			strconv.FormatInt(r.ID, 10),
+			r.StartedAt.Local().Format(time.DateTime),
+			r.Host,
+			strings.Join(decodeList(r.Flags), " "),
+			r.Status,
+			strconv.FormatInt(r.ChangeCount, 10),
+			(time.Duration(r.DurationMs) * time.Millisecond).String(),
 		)
 	}
 
-	// Strict removals
-	if strict {
-		for _, pkg := range diff.ToRemove {
-			t.Row(
-				actionRemove.Render("REMOVE"),
-				pkg,
-				"Not in definitions (strict mode)",
-			)
+	return t
+}
+
+// buildTransactionChangesTable lists the changes of a recorded sync
+func buildTransactionChangesTable(changes []database.TransactionChange) *table.Table {
+	t := table.New().
+		Border(lipgloss.NormalBorder()).
+		Headers("Action", "Package", "Status").
+		StyleFunc(func(row, col int) lipgloss.Style {
+			style := lipgloss.NewStyle().Padding(0, 1)
+			if row == table.HeaderRow {
+				return style.Bold(true)
+			}
+			if col == 2 {
+				return style.Foreground(changeStatusColor(ChangeStatus(changes[row].Status)))
+			}
+			return style
+		})
+
+	for _, c := range changes {
+		t.Row(c.Action, c.Package, c.Status)
+	}
+
+	return t
+}
+
+// buildWhichTable lists the declarations of a package and whether they apply to the host
+func buildWhichTable(decls []Declaration, machine Machine) *table.Table {
+	t := table.New().
+		Border(lipgloss.NormalBorder()).
+		Headers("Declared in", "Entry", "Hosts", "Applies to "+machine.Hostname, "Annotation").
+		StyleFunc(func(row, col int) lipgloss.Style {
+			style := lipgloss.NewStyle().Padding(0, 1)
+			if row == table.HeaderRow {
+				return style.Bold(true)
+			}
+			return style
+		})
+
+	for _, d := range decls {
+		entry := d.Entry
+		if d.Excluded {
+			entry += " (excluded)"
 		}
+		if len(d.When) > 0 {
+			entry += " if " + d.When.String()
+		}
+
+		hosts := d.Scope
+		switch {
+		case hosts == globalScope:
+			hosts = "all"
+		case strings.HasPrefix(hosts, rolePrefix), strings.HasPrefix(hosts, profilePrefix):
+			hosts = scopeLabel(hosts)
+		}
+
+		applies := "no"
+		switch {
+		case d.Excluded || !machine.Covers(d.Scope):
+		case machine.Facts == nil && len(d.When) > 0:
+			applies = "if its conditions hold"
+		case d.When.Holds(machine.Facts):
+			applies = "yes"
+		}
+
+		t.Row(d.String(), entry, hosts, applies, d.Annotation())
 	}
 
-	// Ditto-managed removals
-	for _, pkg := range diff.ToRemoveFromDitto {
-		t.Row(
-			actionRemove.Render("REMOVE"),
-			pkg,
-			"No longer managed by Ditto",
-		)
+	return t
+}
+
+// buildResolveTable lists the effective packages of a host and where they come from
+func buildResolveTable(pkgs []ResolvedPackage) *table.Table {
+	t := table.New().
+		Border(lipgloss.NormalBorder()).
+		Headers("Package", "From", "Declared in", "Annotation").
+		StyleFunc(func(row, col int) lipgloss.Style {
+			style := lipgloss.NewStyle().Padding(0, 1)
+			if row == table.HeaderRow {
+				return style.Bold(true)
+			}
+			return style
+		})
+
+	for _, pkg := range pkgs {
+		name := pkg.Name
+		if pkg.Group != "" {
+			name += " (" + GROUP_PREFIX + pkg.Group + ")"
+		}
+		// Only packages that every declaration gates on unevaluated conditions may be missing
+		if !slices.ContainsFunc(pkg.Sources, func(s PackageSource) bool { return !s.Conditional() }) {
+			var conditions []string
+			for _, source := range pkg.Sources {
+				conditions = appendUnique(conditions, source.When)
+			}
+			name += " if " + strings.Join(conditions, " or ")
+		}
+
+		var declared, annotation string
+		if len(pkg.Sources) > 0 {
+			declared = pkg.Sources[0].String()
+			if more := len(pkg.Sources) - 1; more > 0 {
+				declared += fmt.Sprintf(" and %d more", more)
+			}
+			annotation = pkg.Sources[0].Annotation()
+		}
+
+		t.Row(name, strings.Join(pkg.Origins, ", "), declared, annotation)
 	}
 
 	return t
 }
 
+func transactionStatusColor(status string) lipgloss.Color {
+	switch status {
+	case TransactionApplied:
+		return lipgloss.Color("10")
+	case TransactionFailed:
+		return lipgloss.Color("9")
+	case TransactionAborted:
+		return lipgloss.Color("11")
+	default:
+		return lipgloss.Color("15")
+	}
+}
+
+func changeStatusColor(status ChangeStatus) lipgloss.Color {
+	switch status {
+	case StatusSucceeded:
+		return lipgloss.Color("10")
+	case StatusFailed:
+		return lipgloss.Color("9")
+	case StatusSkipped:
+		return lipgloss.Color("11")
+	default:
+		return lipgloss.Color("15")
+	}
+}
+
+// describeDesired appends why a desired package is wanted, and where, to a reason.
+func describeDesired(reason string, pkg DesiredPackage) string {
+	switch {
+	case pkg.Provides != "":
+		reason = fmt.Sprintf("%s (provides %s)", reason, pkg.Provides)
+	case pkg.Group != "":
+		reason = fmt.Sprintf("%s (group @%s)", reason, pkg.Group)
+	}
+
+	if len(pkg.Sources) > 0 {
+		source := pkg.Sources[0]
+		switch {
+		case source.Profile != "":
+			reason += ", via profile " + source.Profile
+		case source.Role != "":
+			reason += ", via role " + source.Role
+		}
+		reason += ", declared in " + source.String()
+		if more := len(pkg.Sources) - 1; more > 0 {
+			reason += fmt.Sprintf(" and %d more", more)
+		}
+		if note := source.Annotation(); note != "" {
+			reason += " — " + note
+		}
+	}
+	return reason
+}
+
+// describeWhen tells the unevaluated conditions of a source, if any
+func describeWhen(source PackageSource) string {
+	if !source.Conditional() {
+		return ""
+	}
+	return " if " + source.When
+}
+
+// describeExcluded replaces the reason of a removal with the "!pkg" line excluding the package, if any
+func describeExcluded(reason string, diff PackageDiff, pkg string) string {
+	source, ok := diff.Excluded[pkg]
+	if !ok {
+		return reason
+	}
+
+	reason = "Excluded in " + source.String()
+	if note := source.Annotation(); note != "" {
+		reason += " — " + note
+	}
+	return reason
+}
+
 // displayWithOptionalPager renders output via pager (if configured), or directly to stdout.
 func displayWithOptionalPager(appCtx *AppContext, out *bytes.Buffer) {
 	pager := appCtx.Config.Pager
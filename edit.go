@@ -0,0 +1,217 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+type AddOptions struct {
+	// File is the definition file to add to, relative to the packages directory
+	File string
+	// Host puts the file under hosts/, as hosts/<host>.pkgs when File is empty
+	Host    string
+	Install bool
+}
+
+// AddPackages appends packages to a definition file, skipping the ones already
+// declared for the same hosts
+func AddPackages(names []string, opts AddOptions, appCtx *AppContext) error {
+	for _, name := range names {
+		if strings.HasPrefix(name, GROUP_PREFIX) || !validName.MatchString(name) {
+			return fmt.Errorf("invalid package name %q, add only takes package names", name)
+		}
+	}
+
+	file, err := definitionTarget(opts.File, opts.Host)
+	if err != nil {
+		return err
+	}
+
+	scope, err := appCtx.PackageDef.ScopeOf(file)
+	if err != nil {
+		return err
+	}
+
+	defs, err := appCtx.PackageDef.LoadAllDefinitions()
+	if err != nil {
+		return fmt.Errorf("failed to load package definitions: %w", err)
+	}
+
+	hostRoles, err := appCtx.PackageDef.AllHostRoles(appCtx.Config)
+	if err != nil {
+		return fmt.Errorf("failed to read host roles: %w", err)
+	}
+
+	df, err := appCtx.PackageDef.Open(file)
+	if errors.Is(err, fs.ErrNotExist) {
+		df = &DefFile{}
+	} else if err != nil {
+		return fmt.Errorf("failed to read %s: %w", file, err)
+	}
+
+	var added []string
+	for _, name := range names {
+		if slices.Contains(added, name) {
+			continue
+		}
+		if where := declaredIn(defs, name, scope, hostRoles, appCtx.Pacman); len(where) > 0 {
+			fmt.Fprintf(os.Stderr, "Warning: %s is already declared in %s, skipping it\n", name, strings.Join(where, ", "))
+			continue
+		}
+
+		line := df.Append(name)
+		added = append(added, name)
+		fmt.Printf("Added %s to %s:%d\n", name, file, line)
+	}
+
+	if len(added) == 0 {
+		return fmt.Errorf("nothing to add")
+	}
+
+	if err := appCtx.PackageDef.Save(file, df); err != nil {
+		return fmt.Errorf("failed to write %s: %w", file, err)
+	}
+
+	if opts.Install {
+		return appCtx.Pacman.Install(added)
+	}
+	return nil
+}
+
+// RemovePackages deletes the packages from every definition file declaring
+// them, and uninstalls them if asked to
+func RemovePackages(names []string, uninstall bool, appCtx *AppContext) error {
+	defs, err := appCtx.PackageDef.LoadAllDefinitions()
+	if err != nil {
+		return fmt.Errorf("failed to load package definitions: %w", err)
+	}
+
+	removed := make(map[string]bool)
+	for _, def := range defs {
+		declares := false
+		for _, pkg := range def.Packages {
+			if slices.Contains(names, pkg.Name) {
+				fmt.Printf("Removed %s from %s:%d\n", pkg.Name, def.File, pkg.Line)
+				removed[pkg.Name] = true
+				declares = true
+			}
+		}
+		if !declares {
+			continue
+		}
+
+		df, err := appCtx.PackageDef.Open(def.File)
+		if err != nil {
+			return fmt.Errorf("failed to read %s: %w", def.File, err)
+		}
+		for _, name := range names {
+			df.Remove(name)
+		}
+		if err := appCtx.PackageDef.Save(def.File, df); err != nil {
+			return fmt.Errorf("failed to write %s: %w", def.File, err)
+		}
+	}
+
+	for _, name := range names {
+		if !removed[name] {
+			fmt.Fprintf(os.Stderr, "Warning: %s is not declared in any definition file%s\n", name, groupHint(defs, name, appCtx.Pacman))
+		}
+	}
+	if len(removed) == 0 {
+		return fmt.Errorf("nothing to remove")
+	}
+
+	if !uninstall {
+		return nil
+	}
+
+	installed, err := appCtx.Pacman.ListInstalled()
+	if err != nil {
+		return fmt.Errorf("failed to list installed packages: %w", err)
+	}
+	var toUninstall []string
+	for _, pkg := range installed {
+		if removed[pkg.Name] {
+			toUninstall = append(toUninstall, pkg.Name)
+		}
+	}
+	if len(toUninstall) == 0 {
+		return nil
+	}
+	return appCtx.Pacman.Remove(toUninstall)
+}
+
+// definitionTarget returns the definition file to edit, relative to the packages directory
+func definitionTarget(file, host string) (string, error) {
+	if file == "" && host == "" {
+		return "", fmt.Errorf("use --file or --host to choose the definition file")
+	}
+	if file != "" && !strings.HasSuffix(file, FILE_EXTENSION) {
+		file += FILE_EXTENSION
+	}
+	if file != "" && !filepath.IsLocal(file) {
+		return "", fmt.Errorf("%s is outside of the packages directory", file)
+	}
+	if host != "" && (strings.ContainsAny(host, `/\`) || host == "." || host == "..") {
+		return "", fmt.Errorf("invalid host name %q", host)
+	}
+
+	var target string
+	switch {
+	case host != "" && file == "":
+		target = filepath.Join("hosts", host+FILE_EXTENSION)
+	case host != "":
+		target = filepath.Join("hosts", host, file)
+	default:
+		target = file
+	}
+	if !filepath.IsLocal(target) {
+		return "", fmt.Errorf("%s is outside of the packages directory", target)
+	}
+	return target, nil
+}
+
+// declaredIn returns where a package is declared for hosts overlapping the
+// scope, by name or as a member of a group, as "file:line"
+func declaredIn(defs []Definition, name, scope string, roles map[string][]string, groups GroupResolver) []string {
+	var where []string
+	for _, def := range defs {
+		if !scopesOverlap(scope, def.Scope(), roles) {
+			continue
+		}
+		for _, pkg := range def.Packages {
+			if pkg.Name == name {
+				where = append(where, fmt.Sprintf("%s:%d", def.File, pkg.Line))
+			}
+		}
+		for _, group := range def.Groups {
+			if slices.Contains(group.Exclude, name) {
+				continue
+			}
+			members, err := groups.GroupMembers(group.Name)
+			if err == nil && slices.Contains(members, name) {
+				where = append(where, fmt.Sprintf("%s:%d (%s%s)", def.File, group.Line, GROUP_PREFIX, group.Name))
+			}
+		}
+	}
+	return where
+}
+
+// groupHint explains how to drop a package that is only wanted through a group
+func groupHint(defs []Definition, name string, groups GroupResolver) string {
+	for _, def := range defs {
+		for _, group := range def.Groups {
+			members, err := groups.GroupMembers(group.Name)
+			if err == nil && slices.Contains(members, name) && !slices.Contains(group.Exclude, name) {
+				return fmt.Sprintf(" (it comes from %s%s at %s:%d, add %s%s there to exclude it)",
+					GROUP_PREFIX, group.Name, def.File, group.Line, EXCLUDE_PREFIX, name)
+			}
+		}
+	}
+	return ""
+}
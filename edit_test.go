@@ -0,0 +1,77 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestAddPackagesRejectsInvalidNames(t *testing.T) {
+	appCtx := newTestAppContext(t, "")
+
+	for _, name := range []string{"@gnome", "!foo", "[if x]", "a b", "#x", "-f", ""} {
+		if err := AddPackages([]string{"neovim", name}, AddOptions{File: "dev.pkgs"}, appCtx); err == nil {
+			t.Errorf("AddPackages(%q) succeeded, want an error", name)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(appCtx.PackageDef.path, "dev.pkgs")); !os.IsNotExist(err) {
+		t.Errorf("dev.pkgs was written along with an invalid name: %v", err)
+	}
+}
+
+// TestAddPackagesSkipsGroupMembers adds gnome-shell, a member of the gnome
+// group in the extra repository fixture
+func TestAddPackagesSkipsGroupMembers(t *testing.T) {
+	tests := []struct {
+		name      string
+		files     map[string]string
+		opts      AddOptions
+		wantAdded bool
+	}{
+		{
+			name:  "member of a global group",
+			files: map[string]string{"desktop.pkgs": "@gnome\n"},
+			opts:  AddOptions{Host: "laptop"},
+		},
+		{
+			name:  "member of a group of the host",
+			files: map[string]string{"hosts/laptop.pkgs": "@gnome\n"},
+			opts:  AddOptions{File: "desktop.pkgs"},
+		},
+		{
+			name:      "member excluded from the group",
+			files:     map[string]string{"hosts/laptop.pkgs": "@gnome !gnome-shell\n"},
+			opts:      AddOptions{Host: "laptop"},
+			wantAdded: true,
+		},
+		{
+			name:      "member of a group of another host",
+			files:     map[string]string{"hosts/tower.pkgs": "@gnome\n"},
+			opts:      AddOptions{Host: "laptop"},
+			wantAdded: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			appCtx := newTestAppContext(t, "")
+			for file, content := range tt.files {
+				path := filepath.Join(appCtx.PackageDef.path, file)
+				if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+					t.Fatal(err)
+				}
+				if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			root := t.TempDir()
+			writeSyncDB(t, root, "extra", false)
+			appCtx.Pacman = NewPacman(&Config{DBPath: root})
+
+			err := AddPackages([]string{"gnome-shell"}, tt.opts, appCtx)
+			if added := err == nil; added != tt.wantAdded {
+				t.Errorf("AddPackages() error = %v, want gnome-shell added: %v", err, tt.wantAdded)
+			}
+		})
+	}
+}
@@ -0,0 +1,237 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// Facts are what ditto detects about the machine, for "[if fact == "value"]"
+// blocks. A fact can have several values, e.g. one GPU vendor per card.
+type Facts map[string][]string
+
+// factNames are the facts a condition can test, in the order "ditto facts" prints them
+var factNames = []string{
+	"cpu.vendor",
+	"cpu.model",
+	"gpu.vendor",
+	"system.vendor",
+	"system.product",
+	"chassis",
+	"virt",
+	"battery",
+	"laptop",
+}
+
+// cpuVendors maps the vendor_id of /proc/cpuinfo to short names
+var cpuVendors = map[string]string{
+	"AuthenticAMD": "amd",
+	"GenuineIntel": "intel",
+}
+
+// pciVendors maps the PCI vendor IDs of GPUs to short names
+var pciVendors = map[string]string{
+	"0x10de": "nvidia",
+	"0x1002": "amd",
+	"0x8086": "intel",
+	"0x1af4": "virtio",
+	"0x15ad": "vmware",
+	"0x1234": "qemu",
+	"0x80ee": "virtualbox",
+}
+
+// chassisTypes maps the SMBIOS chassis types of /sys/class/dmi/id/chassis_type to names
+var chassisTypes = map[string]string{
+	"3": "desktop", "4": "desktop", "5": "desktop", "6": "desktop", "7": "desktop",
+	"13": "desktop", "15": "desktop", "16": "desktop", "24": "desktop", "35": "desktop", "36": "desktop",
+	"8": "laptop", "9": "laptop", "10": "laptop", "14": "laptop",
+	"30": "tablet", "31": "convertible", "32": "detachable",
+	"17": "server", "23": "server", "28": "server", "29": "server",
+}
+
+// dmiVirt tells the hypervisor from the DMI vendor or product name, like systemd-detect-virt
+var dmiVirt = []struct{ prefix, virt string }{
+	{"KVM", "kvm"},
+	{"QEMU", "qemu"},
+	{"VMware", "vmware"},
+	{"VMW", "vmware"},
+	{"innotek GmbH", "oracle"},
+	{"VirtualBox", "oracle"},
+	{"Xen", "xen"},
+	{"Bochs", "bochs"},
+	{"Parallels", "parallels"},
+	{"BHYVE", "bhyve"},
+	{"Amazon EC2", "amazon"},
+}
+
+func isFactName(name string) bool {
+	return slices.Contains(factNames, name)
+}
+
+// collectFacts detects the facts of the machine whose filesystem is at root,
+// "/" for this one. Files that are missing or unreadable leave their facts unset.
+func collectFacts(root string) Facts {
+	read := func(path string) string {
+		data, err := os.ReadFile(filepath.Join(root, path))
+		if err != nil {
+			return ""
+		}
+		return strings.TrimSpace(string(data))
+	}
+	exists := func(path string) bool {
+		_, err := os.Stat(filepath.Join(root, path))
+		return err == nil
+	}
+
+	facts := make(Facts)
+	set := func(name, value string) {
+		if value != "" && !slices.Contains(facts[name], value) {
+			facts[name] = append(facts[name], value)
+		}
+	}
+
+	cpuinfo := parseCPUInfo(read("proc/cpuinfo"))
+	vendor := cpuinfo["vendor_id"]
+	if short, ok := cpuVendors[vendor]; ok {
+		vendor = short
+	}
+	set("cpu.vendor", strings.ToLower(vendor))
+	set("cpu.model", cpuinfo["model name"])
+
+	cards, _ := filepath.Glob(filepath.Join(root, "sys/class/drm/card*/device/vendor"))
+	slices.Sort(cards)
+	for _, card := range cards {
+		rel, err := filepath.Rel(root, card)
+		if err != nil {
+			continue
+		}
+		id := strings.ToLower(read(rel))
+		if name, ok := pciVendors[id]; ok {
+			id = name
+		}
+		set("gpu.vendor", id)
+	}
+
+	sysVendor, product := read("sys/class/dmi/id/sys_vendor"), read("sys/class/dmi/id/product_name")
+	set("system.vendor", sysVendor)
+	set("system.product", product)
+
+	chassis := chassisTypes[read("sys/class/dmi/id/chassis_type")]
+	if chassis == "" && exists("sys/class/dmi/id/chassis_type") {
+		chassis = "other"
+	}
+	set("chassis", chassis)
+
+	set("virt", detectVirt(read, exists, sysVendor, product, cpuinfo["flags"]))
+
+	battery := "false"
+	supplies, _ := filepath.Glob(filepath.Join(root, "sys/class/power_supply/*/type"))
+	for _, supply := range supplies {
+		if data, err := os.ReadFile(supply); err == nil && strings.TrimSpace(string(data)) == "Battery" {
+			battery = "true"
+			break
+		}
+	}
+	set("battery", battery)
+
+	laptop := "false"
+	if battery == "true" || chassis == "laptop" || chassis == "convertible" || chassis == "detachable" {
+		laptop = "true"
+	}
+	set("laptop", laptop)
+
+	return facts
+}
+
+// parseCPUInfo returns the fields of the first processor of /proc/cpuinfo
+func parseCPUInfo(content string) map[string]string {
+	fields := make(map[string]string)
+	scanner := bufio.NewScanner(strings.NewReader(content))
+	for scanner.Scan() {
+		line := scanner.Text()
+		if strings.TrimSpace(line) == "" {
+			if len(fields) > 0 {
+				break
+			}
+			continue
+		}
+		key, value, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		fields[strings.TrimSpace(key)] = strings.TrimSpace(value)
+	}
+	return fields
+}
+
+// detectVirt tells the container or hypervisor the machine runs in, "none" on
+// bare metal, with the same checks and names as systemd-detect-virt
+func detectVirt(read func(string) string, exists func(string) bool, sysVendor, product, cpuFlags string) string {
+	switch {
+	case exists(".dockerenv"):
+		return "docker"
+	case exists("run/.containerenv"):
+		return "podman"
+	}
+	for _, env := range strings.Split(read("proc/1/environ"), "\x00") {
+		if container, ok := strings.CutPrefix(env, "container="); ok && container != "" {
+			return container
+		}
+	}
+	if release := strings.ToLower(read("proc/sys/kernel/osrelease")); strings.Contains(release, "microsoft") {
+		return "wsl"
+	}
+
+	for _, dmi := range dmiVirt {
+		if strings.HasPrefix(sysVendor, dmi.prefix) || strings.HasPrefix(product, dmi.prefix) {
+			return dmi.virt
+		}
+	}
+	if sysVendor == "Microsoft Corporation" && product == "Virtual Machine" {
+		return "microsoft"
+	}
+	if exists("proc/xen") {
+		return "xen"
+	}
+	if slices.Contains(strings.Fields(cpuFlags), "hypervisor") {
+		return "vm-other"
+	}
+	return "none"
+}
+
+// FactsReport is what "ditto facts --output json" prints
+type FactsReport struct {
+	FormatVersion int    `json:"format_version" yaml:"format_version"`
+	Root          string `json:"root" yaml:"root"`
+	Facts         Facts  `json:"facts" yaml:"facts"`
+}
+
+type FactsOptions struct {
+	Output OutputFormat
+}
+
+// PrintFacts prints the facts detected on this machine, or under the facts root of the config
+func PrintFacts(opts FactsOptions, appCtx *AppContext) error {
+	root := appCtx.Config.FactsRoot
+	facts := collectFacts(root)
+
+	if opts.Output.Structured() {
+		return writeReport(os.Stdout, opts.Output, FactsReport{FormatVersion: reportFormatVersion, Root: root, Facts: facts})
+	}
+
+	width := 0
+	for _, name := range factNames {
+		width = max(width, len(name))
+	}
+	for _, name := range factNames {
+		value := strings.Join(facts[name], ", ")
+		if value == "" {
+			value = "-"
+		}
+		fmt.Printf("%-*s  %s\n", width, name, value)
+	}
+	return nil
+}
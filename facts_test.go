@@ -0,0 +1,77 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestCollectFacts(t *testing.T) {
+	tests := []struct {
+		root string
+		want Facts
+	}{
+		{
+			root: "testdata/facts/thinkpad",
+			want: Facts{
+				"cpu.vendor":     {"amd"},
+				"cpu.model":      {"AMD Ryzen 7 PRO 7840U w/ Radeon 780M Graphics"},
+				"gpu.vendor":     {"amd", "nvidia"},
+				"system.vendor":  {"LENOVO"},
+				"system.product": {"ThinkPad T14s Gen 4"},
+				"chassis":        {"laptop"},
+				"virt":           {"none"},
+				"battery":        {"true"},
+				"laptop":         {"true"},
+			},
+		},
+		{
+			root: "testdata/facts/vm",
+			want: Facts{
+				"cpu.vendor":     {"intel"},
+				"cpu.model":      {"Intel Xeon Processor (Icelake)"},
+				"gpu.vendor":     {"qemu"},
+				"system.vendor":  {"QEMU"},
+				"system.product": {"Standard PC (Q35 + ICH9, 2009)"},
+				"chassis":        {"other"},
+				"virt":           {"qemu"},
+				"battery":        {"false"},
+				"laptop":         {"false"},
+			},
+		},
+		{
+			// Nothing can be read, only the facts with a default are set
+			root: "testdata/facts/missing",
+			want: Facts{
+				"virt":    {"none"},
+				"battery": {"false"},
+				"laptop":  {"false"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.root, func(t *testing.T) {
+			if got := collectFacts(tt.root); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("collectFacts() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHostFacts(t *testing.T) {
+	t.Setenv(hostEnv, "workstation")
+	cfg := &Config{
+		FactsRoot:  "testdata/facts/vm",
+		FactsRoots: map[string]string{"thinkpad": "testdata/facts/thinkpad"},
+	}
+
+	if facts := hostFacts("thinkpad", cfg); !reflect.DeepEqual(facts["cpu.vendor"], []string{"amd"}) {
+		t.Errorf("hostFacts(thinkpad) = %v, want the facts of its factsRoots entry", facts)
+	}
+	if facts := hostFacts("workstation", cfg); !reflect.DeepEqual(facts["cpu.vendor"], []string{"intel"}) {
+		t.Errorf("hostFacts(workstation) = %v, want the facts under factsRoot", facts)
+	}
+	if facts := hostFacts("build-01", cfg); facts != nil {
+		t.Errorf("hostFacts(build-01) = %v, want nil", facts)
+	}
+}
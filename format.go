@@ -0,0 +1,299 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"slices"
+	"sort"
+	"strings"
+)
+
+const (
+	// diffContext is the number of unchanged lines shown around a change
+	diffContext = 3
+	// blockIndent indents the lines of [if] blocks, once per level
+	blockIndent = "  "
+)
+
+type FmtOptions struct {
+	// Check only reports the files that are not formatted, with a diff
+	Check bool
+}
+
+// Fmt rewrites definition files in canonical form. Files are given as paths
+// inside the packages directory, every definition file when there are none.
+func Fmt(files []string, opts FmtOptions, appCtx *AppContext) error {
+	pd := appCtx.PackageDef
+
+	if len(files) == 0 {
+		all, err := pd.Files()
+		if err != nil {
+			return fmt.Errorf("failed to list package definitions: %w", err)
+		}
+		files = all
+	} else {
+		for i, file := range files {
+			rel, err := pd.Rel(file)
+			if err != nil {
+				return err
+			}
+			files[i] = rel
+		}
+	}
+
+	var unformatted, invalid int
+	for _, file := range files {
+		df, err := pd.Open(file)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			invalid++
+			continue
+		}
+
+		before := df.Bytes()
+		after := formatDefFile(df)
+		if string(before) == string(after) {
+			continue
+		}
+		unformatted++
+
+		if opts.Check {
+			fmt.Print(unifiedDiff(file, splitLines(before), splitLines(after)))
+			continue
+		}
+		if err := pd.WriteFile(file, after); err != nil {
+			return fmt.Errorf("failed to write %s: %w", file, err)
+		}
+		fmt.Printf("Formatted %s\n", file)
+	}
+
+	if invalid > 0 {
+		return fmt.Errorf("%d file(s) could not be parsed, fix them first", invalid)
+	}
+	if opts.Check && unformatted > 0 {
+		return fmt.Errorf("%d file(s) are not formatted, run 'ditto fmt'", unformatted)
+	}
+	return nil
+}
+
+// formatDefFile renders a definition file in canonical form: entries sorted and
+// deduplicated within each section delimited by comments, blank lines or [if]
+// directives, inline comments aligned, [if] blocks indented and whitespace
+// normalized. No comment is dropped.
+func formatDefFile(df *DefFile) []byte {
+	// Duplicates under the same conditions are dropped, but their inline
+	// comments are kept on the first entry
+	key := func(line DefLine) string {
+		return line.When.String() + "\x00" + entryText(line)
+	}
+	comments := make(map[string][]string)
+	for _, line := range df.Lines {
+		if isEntry(line) && line.Comment != "" {
+			comments[key(line)] = appendUnique(comments[key(line)], line.Comment)
+		}
+	}
+
+	var out []string
+	var section []DefLine
+	seen := make(map[string]bool)
+	flush := func() {
+		sort.SliceStable(section, func(i, j int) bool {
+			if oi, oj := entryOrder(section[i]), entryOrder(section[j]); oi != oj {
+				return oi < oj
+			}
+			return entryText(section[i]) < entryText(section[j])
+		})
+
+		width := 0
+		for _, line := range section {
+			if len(comments[key(line)]) > 0 {
+				width = max(width, len(entryText(line)))
+			}
+		}
+		for _, line := range section {
+			text := entryText(line)
+			if comment := strings.Join(comments[key(line)], "; "); comment != "" {
+				text = fmt.Sprintf("%-*s # %s", width, text, comment)
+			}
+			out = append(out, indent(line)+text)
+		}
+		section = nil
+	}
+
+	for _, line := range df.Lines {
+		switch {
+		case isEntry(line):
+			if !seen[key(line)] {
+				seen[key(line)] = true
+				section = append(section, line)
+			}
+		case line.Kind == LineBlank:
+			flush()
+			if len(out) > 0 && out[len(out)-1] != "" {
+				out = append(out, "")
+			}
+		case line.Kind == LineIf || line.Kind == LineElse || line.Kind == LineEnd:
+			flush()
+			text := directiveText(line)
+			if line.Comment != "" {
+				text += " # " + line.Comment
+			}
+			out = append(out, indent(line)+text)
+		default:
+			flush()
+			out = append(out, indent(line)+strings.TrimSpace(line.Raw))
+		}
+	}
+	flush()
+
+	for len(out) > 0 && out[len(out)-1] == "" {
+		out = out[:len(out)-1]
+	}
+	if len(out) == 0 {
+		return nil
+	}
+	return []byte(strings.Join(out, "\n") + "\n")
+}
+
+func isEntry(line DefLine) bool {
+	return line.Kind == LinePackage || line.Kind == LineGroup || line.Kind == LineExclude
+}
+
+// indent is the indentation of a line, one level per enclosing [if] block
+func indent(line DefLine) string {
+	return strings.Repeat(blockIndent, len(line.When))
+}
+
+// directiveText is the canonical text of an [if], [else] or [end] line, without its comment
+func directiveText(line DefLine) string {
+	switch line.Kind {
+	case LineIf:
+		return line.Cond.Directive()
+	case LineElse:
+		return DIRECTIVE_ELSE
+	default:
+		return DIRECTIVE_END
+	}
+}
+
+// entryOrder sorts groups first and exclusions last within a section
+func entryOrder(line DefLine) int {
+	switch line.Kind {
+	case LineGroup:
+		return 0
+	case LinePackage:
+		return 1
+	default:
+		return 2
+	}
+}
+
+// entryText is the canonical text of an entry line, without its comment
+func entryText(line DefLine) string {
+	switch line.Kind {
+	case LinePackage:
+		return line.Name
+	case LineExclude:
+		return EXCLUDE_PREFIX + line.Name
+	}
+
+	exclude := slices.Clone(line.Group.Exclude)
+	slices.Sort(exclude)
+	fields := []string{GROUP_PREFIX + line.Group.Name}
+	for _, name := range slices.Compact(exclude) {
+		fields = append(fields, EXCLUDE_PREFIX+name)
+	}
+	return strings.Join(fields, " ")
+}
+
+func splitLines(data []byte) []string {
+	content := strings.TrimSuffix(string(data), "\n")
+	if content == "" {
+		return nil
+	}
+	return strings.Split(content, "\n")
+}
+
+// unifiedDiff renders the changes from a to b as a unified diff
+func unifiedDiff(name string, a, b []string) string {
+	type op struct {
+		kind byte
+		line string
+		// aLine and bLine are the 0-based positions before the operation
+		aLine, bLine int
+	}
+
+	// Longest common subsequence of every suffix of a and b
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	var ops []op
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		switch {
+		case i < len(a) && j < len(b) && a[i] == b[j]:
+			ops = append(ops, op{' ', a[i], i, j})
+			i, j = i+1, j+1
+		case i < len(a) && (j == len(b) || lcs[i+1][j] >= lcs[i][j+1]):
+			ops = append(ops, op{'-', a[i], i, j})
+			i++
+		default:
+			ops = append(ops, op{'+', b[j], i, j})
+			j++
+		}
+	}
+
+	var out strings.Builder
+	fmt.Fprintf(&out, "--- a/%s\n+++ b/%s\n", name, name)
+
+	for start := 0; start < len(ops); {
+		if ops[start].kind == ' ' {
+			start++
+			continue
+		}
+
+		// Extend the hunk while the next change is close enough to share context
+		end := start
+		for k := start; k < len(ops) && k <= end+2*diffContext; k++ {
+			if ops[k].kind != ' ' {
+				end = k
+			}
+		}
+		from, to := max(start-diffContext, 0), min(end+diffContext+1, len(ops))
+
+		var aCount, bCount int
+		var body strings.Builder
+		for _, o := range ops[from:to] {
+			fmt.Fprintf(&body, "%c%s\n", o.kind, o.line)
+			if o.kind != '+' {
+				aCount++
+			}
+			if o.kind != '-' {
+				bCount++
+			}
+		}
+
+		aStart, bStart := ops[from].aLine+1, ops[from].bLine+1
+		if aCount == 0 {
+			aStart--
+		}
+		if bCount == 0 {
+			bStart--
+		}
+		fmt.Fprintf(&out, "@@ -%d,%d +%d,%d @@\n%s", aStart, aCount, bStart, bCount, body.String())
+		start = to
+	}
+
+	return out.String()
+}
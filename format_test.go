@@ -0,0 +1,91 @@
+package main
+
+import (
+	"os"
+	"testing"
+)
+
+func TestFormatDefFile(t *testing.T) {
+	input, err := os.ReadFile("testdata/fmt/messy.pkgs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	golden, err := os.ReadFile("testdata/fmt/messy.golden")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	df, err := parseDefContent("messy.pkgs", input)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := string(formatDefFile(df)); got != string(golden) {
+		t.Errorf("formatDefFile() =\n%s\nwant\n%s\n%s", got, golden, unifiedDiff("messy.pkgs", splitLines(golden), splitLines([]byte(got))))
+	}
+
+	// A formatted file is left as is
+	df, err = parseDefContent("messy.golden", golden)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := string(formatDefFile(df)); got != string(golden) {
+		t.Errorf("formatting twice changed the file:\n%s", unifiedDiff("messy.golden", splitLines(golden), splitLines([]byte(got))))
+	}
+}
+
+func TestFormatDefFileEmpty(t *testing.T) {
+	df, err := parseDefContent("empty.pkgs", []byte("\n  \n\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := formatDefFile(df); got != nil {
+		t.Errorf("formatDefFile() = %q, want nil", got)
+	}
+}
+
+func TestUnifiedDiff(t *testing.T) {
+	tests := []struct {
+		name string
+		a, b []string
+		want string
+	}{
+		{
+			name: "identical",
+			a:    []string{"a", "b"},
+			b:    []string{"a", "b"},
+			want: "--- a/f.pkgs\n+++ b/f.pkgs\n",
+		},
+		{
+			name: "new file",
+			b:    []string{"x"},
+			want: "--- a/f.pkgs\n+++ b/f.pkgs\n@@ -0,0 +1,1 @@\n+x\n",
+		},
+		{
+			name: "deleted file",
+			a:    []string{"x", "y"},
+			want: "--- a/f.pkgs\n+++ b/f.pkgs\n@@ -1,2 +0,0 @@\n-x\n-y\n",
+		},
+		{
+			name: "distant changes",
+			a:    []string{"a", "b", "c", "d", "e", "f", "g", "h", "i", "j"},
+			b:    []string{"a", "B", "c", "d", "e", "f", "g", "h", "i", "J"},
+			want: "--- a/f.pkgs\n+++ b/f.pkgs\n" +
+				"@@ -1,5 +1,5 @@\n a\n-b\n+B\n c\n d\n e\n" +
+				"@@ -7,4 +7,4 @@\n g\n h\n i\n-j\n+J\n",
+		},
+		{
+			name: "close changes share a hunk",
+			a:    []string{"a", "b", "c", "d", "e", "f"},
+			b:    []string{"b", "c", "d", "e", "f", "g"},
+			want: "--- a/f.pkgs\n+++ b/f.pkgs\n@@ -1,6 +1,6 @@\n-a\n b\n c\n d\n e\n f\n+g\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := unifiedDiff("f.pkgs", tt.a, tt.b); got != tt.want {
+				t.Errorf("unifiedDiff() =\n%s\nwant\n%s", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ony-boom/ditto/database"
+)
+
+// newTestAppContext returns a context reading the pacman database fixture of
+// testdata/pacman, with a migrated database and a copy of the packages
+// directory fixture, empty when packages is ""
+func newTestAppContext(t *testing.T, packages string) *AppContext {
+	t.Helper()
+
+	dir := filepath.Join(t.TempDir(), "packages")
+	if packages != "" {
+		if err := os.CopyFS(dir, os.DirFS(packages)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	db := openTestDB(t)
+	if err := migrate(context.Background(), db); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := &Config{DBPath: "testdata/pacman", FactsRoot: "testdata/facts/missing"}
+	return &AppContext{
+		Config:      cfg,
+		Pacman:      NewPacman(cfg),
+		QueryClient: database.New(db),
+		PackageDef:  &PackageDef{path: dir},
+	}
+}
+
+// loadTestDefinitions writes the given files, by path relative to the
+// packages directory, and loads them
+func loadTestDefinitions(t *testing.T, files map[string]string) []Definition {
+	t.Helper()
+
+	dir := t.TempDir()
+	for file, content := range files {
+		path := filepath.Join(dir, file)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	defs, err := (&PackageDef{path: dir}).LoadAllDefinitions()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return defs
+}
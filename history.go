@@ -0,0 +1,287 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/ony-boom/ditto/database"
+)
+
+// ChangeAction is what a sync does to a package
+type ChangeAction string
+
+const (
+	ActionInstall         ChangeAction = "install"
+	ActionMarkExplicit    ChangeAction = "mark-explicit"
+	ActionDemote          ChangeAction = "demote"
+	ActionRemove          ChangeAction = "remove"
+	ActionRemoveUnmanaged ChangeAction = "remove-unmanaged"
+)
+
+// ChangeStatus is the outcome of a change
+type ChangeStatus string
+
+const (
+	StatusPlanned   ChangeStatus = "planned"
+	StatusSucceeded ChangeStatus = "succeeded"
+	StatusFailed    ChangeStatus = "failed"
+	StatusSkipped   ChangeStatus = "skipped"
+)
+
+// Status of a whole sync transaction
+const (
+	TransactionApplied   = "applied"
+	TransactionFailed    = "failed"
+	TransactionAborted   = "aborted"
+	TransactionUnchanged = "unchanged"
+)
+
+// Change is a single action of a sync on a package
+type Change struct {
+	Action  ChangeAction
+	Package string
+	Status  ChangeStatus
+	// Version is the version removed by a removal, or installed by an install
+	Version string
+}
+
+// ApplyResult records what happened to each change of a sync
+type ApplyResult struct {
+	Changes []Change
+	Aborted bool
+}
+
+// plannedChanges lists the changes a diff will apply, in the order they run
+func plannedChanges(diff PackageDiff, strict bool) []Change {
+	var changes []Change
+	add := func(action ChangeAction, pkgs []string) {
+		for _, pkg := range pkgs {
+			changes = append(changes, Change{Action: action, Package: pkg, Status: StatusPlanned})
+		}
+	}
+
+	add(ActionInstall, diff.ToAdd)
+	if strict {
+		add(ActionMarkExplicit, diff.ToMarkExplicit)
+		add(ActionDemote, diff.ToRemove)
+	}
+	add(ActionRemoveUnmanaged, diff.ToRemoveFromDitto)
+
+	return changes
+}
+
+// settle sets the outcome of the planned changes of an action run on pkgs
+func (r *ApplyResult) settle(action ChangeAction, pkgs []string, err error) {
+	status := StatusSucceeded
+	if err != nil {
+		status = StatusFailed
+	}
+
+	for i, change := range r.Changes {
+		if change.Action == action && change.Status == StatusPlanned && slices.Contains(pkgs, change.Package) {
+			r.Changes[i].Status = status
+		}
+	}
+}
+
+// record appends changes that were not planned upfront, like orphan removals
+func (r *ApplyResult) record(action ChangeAction, pkgs []string, err error) {
+	status := StatusSucceeded
+	if err != nil {
+		status = StatusFailed
+	}
+
+	for _, pkg := range pkgs {
+		r.Changes = append(r.Changes, Change{Action: action, Package: pkg, Status: status})
+	}
+}
+
+// skipRemaining marks the changes that never ran as skipped
+func (r *ApplyResult) skipRemaining() {
+	for i, change := range r.Changes {
+		if change.Status == StatusPlanned {
+			r.Changes[i].Status = StatusSkipped
+		}
+	}
+}
+
+// fillVersions records the version each change touched: the version present
+// before the sync for removals, and the one present after it for the rest
+func (r *ApplyResult) fillVersions(before, after []InstalledPackage) {
+	versionsBefore := installedVersions(before)
+	versionsAfter := installedVersions(after)
+
+	for i, change := range r.Changes {
+		switch change.Action {
+		case ActionRemove, ActionRemoveUnmanaged:
+			r.Changes[i].Version = versionsBefore[change.Package]
+		default:
+			r.Changes[i].Version = versionsAfter[change.Package]
+		}
+	}
+}
+
+func installedVersions(pkgs []InstalledPackage) map[string]string {
+	versions := make(map[string]string, len(pkgs))
+	for _, pkg := range pkgs {
+		versions[pkg.Name] = pkg.Version
+	}
+	return versions
+}
+
+// Flags returns the sync options worth recording with a transaction
+func (opts SyncOptions) Flags() []string {
+	var flags []string
+	if opts.Strict {
+		flags = append(flags, "strict")
+	}
+	if opts.FromPlan {
+		flags = append(flags, "plan")
+	}
+	return flags
+}
+
+// TransactionInfo describes a run to record in the history
+type TransactionInfo struct {
+	Started     time.Time
+	Host        string
+	Flags       []string
+	InstallArgs []string
+	RemoveArgs  []string
+}
+
+// recordTransaction stores a run and the outcome of each of its changes
+func recordTransaction(
+	ctx context.Context,
+	queries *database.Queries,
+	info TransactionInfo,
+	result *ApplyResult,
+	applyErr error,
+) error {
+	status := transactionStatus(result, applyErr)
+
+	var errMsg sql.NullString
+	if applyErr != nil {
+		errMsg = sql.NullString{String: applyErr.Error(), Valid: true}
+	}
+
+	tx, err := queries.CreateTransaction(ctx, database.CreateTransactionParams{
+		StartedAt:   info.Started,
+		DurationMs:  time.Since(info.Started).Milliseconds(),
+		Host:        info.Host,
+		Flags:       encodeList(info.Flags),
+		InstallArgs: encodeList(info.InstallArgs),
+		RemoveArgs:  encodeList(info.RemoveArgs),
+		Status:      status,
+		Error:       errMsg,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to record transaction: %w", err)
+	}
+
+	for _, change := range result.Changes {
+		if err := queries.CreateTransactionChange(ctx, database.CreateTransactionChangeParams{
+			TransactionID: tx.ID,
+			Action:        string(change.Action),
+			Package:       change.Package,
+			Status:        string(change.Status),
+			Version:       sql.NullString{String: change.Version, Valid: change.Version != ""},
+		}); err != nil {
+			return fmt.Errorf("failed to record change %s %s: %w", change.Action, change.Package, err)
+		}
+	}
+
+	return nil
+}
+
+// transactionStatus sums up the outcome of a run
+func transactionStatus(result *ApplyResult, applyErr error) string {
+	switch {
+	case applyErr != nil:
+		return TransactionFailed
+	case result.Aborted:
+		return TransactionAborted
+	case len(result.Changes) == 0:
+		return TransactionUnchanged
+	default:
+		return TransactionApplied
+	}
+}
+
+func historyListAction(ctx context.Context, appCtx *AppContext, limit int64) error {
+	rows, err := appCtx.QueryClient.ListTransactions(ctx, limit)
+	if err != nil {
+		return fmt.Errorf("failed to list transactions: %w", err)
+	}
+
+	if len(rows) == 0 {
+		fmt.Println("No syncs recorded yet.")
+		return nil
+	}
+
+	var out bytes.Buffer
+	out.WriteString(buildHistoryTable(rows).String())
+	out.WriteString("\n")
+	displayWithOptionalPager(appCtx, &out)
+	return nil
+}
+
+func historyShowAction(ctx context.Context, appCtx *AppContext, id int64) error {
+	tx, err := appCtx.QueryClient.GetTransaction(ctx, id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("no sync with id %d", id)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to get transaction: %w", err)
+	}
+
+	changes, err := appCtx.QueryClient.GetTransactionChanges(ctx, id)
+	if err != nil {
+		return fmt.Errorf("failed to get transaction changes: %w", err)
+	}
+
+	var out bytes.Buffer
+	fmt.Fprintf(&out, "Sync #%d\n", tx.ID)
+	fmt.Fprintf(&out, "  Date:         %s\n", tx.StartedAt.Local().Format(time.DateTime))
+	fmt.Fprintf(&out, "  Host:         %s\n", tx.Host)
+	fmt.Fprintf(&out, "  Flags:        %s\n", strings.Join(decodeList(tx.Flags), " "))
+	fmt.Fprintf(&out, "  Install args: %s\n", strings.Join(decodeList(tx.InstallArgs), " "))
+	fmt.Fprintf(&out, "  Remove args:  %s\n", strings.Join(decodeList(tx.RemoveArgs), " "))
+	fmt.Fprintf(&out, "  Status:       %s\n", tx.Status)
+	fmt.Fprintf(&out, "  Duration:     %s\n", time.Duration(tx.DurationMs)*time.Millisecond)
+	if tx.Error.Valid {
+		fmt.Fprintf(&out, "  Error:        %s\n", tx.Error.String)
+	}
+
+	if len(changes) > 0 {
+		out.WriteString("\n")
+		out.WriteString(buildTransactionChangesTable(changes).String())
+		out.WriteString("\n")
+	}
+
+	displayWithOptionalPager(appCtx, &out)
+	return nil
+}
+
+// encodeList stores a list of strings as a JSON array
+func encodeList(values []string) string {
+	if values == nil {
+		values = []string{}
+	}
+	data, _ := json.Marshal(values)
+	return string(data)
+}
+
+// decodeList reads a list stored by encodeList
+func decodeList(value string) []string {
+	var values []string
+	_ = json.Unmarshal([]byte(value), &values)
+	return values
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/ony-boom/ditto/database"
+)
+
+func TestApplyResult(t *testing.T) {
+	diff := PackageDiff{
+		ToAdd:             []string{"neovim", "fd"},
+		ToMarkExplicit:    []string{"groff"},
+		ToRemove:          []string{"man-db"},
+		ToRemoveFromDitto: []string{"zsh"},
+	}
+
+	// Strict-only changes are planned in strict mode only
+	if got := plannedChanges(diff, false); len(got) != 3 {
+		t.Errorf("plannedChanges(strict = false) = %+v, want the installs and the removal", got)
+	}
+
+	result := &ApplyResult{Changes: plannedChanges(diff, true)}
+	result.settle(ActionInstall, []string{"neovim"}, nil)
+	result.settle(ActionInstall, []string{"fd"}, errors.New("target not found"))
+	result.settle(ActionMarkExplicit, diff.ToMarkExplicit, nil)
+	result.record(ActionRemove, []string{"lua"}, nil)
+	result.skipRemaining()
+
+	before := []InstalledPackage{{Name: "man-db", Version: "2.12.1-1"}, {Name: "zsh", Version: "5.9-5"}, {Name: "lua", Version: "5.4.7-1"}}
+	after := []InstalledPackage{{Name: "neovim", Version: "0.10.0-1"}, {Name: "groff", Version: "1.23.0-6"}, {Name: "man-db", Version: "2.12.1-1"}, {Name: "zsh", Version: "5.9-5"}}
+	result.fillVersions(before, after)
+
+	want := []Change{
+		{ActionInstall, "neovim", StatusSucceeded, "0.10.0-1"},
+		{ActionInstall, "fd", StatusFailed, ""},
+		{ActionMarkExplicit, "groff", StatusSucceeded, "1.23.0-6"},
+		{ActionDemote, "man-db", StatusSkipped, "2.12.1-1"},
+		{ActionRemoveUnmanaged, "zsh", StatusSkipped, "5.9-5"},
+		// Removals keep the version they removed
+		{ActionRemove, "lua", StatusSucceeded, "5.4.7-1"},
+	}
+	if !reflect.DeepEqual(result.Changes, want) {
+		t.Errorf("Changes = %+v, want %+v", result.Changes, want)
+	}
+}
+
+func TestTransactionStatus(t *testing.T) {
+	changes := []Change{{Action: ActionInstall, Package: "git", Status: StatusSucceeded}}
+
+	tests := []struct {
+		name   string
+		result *ApplyResult
+		err    error
+		want   string
+	}{
+		{"applied", &ApplyResult{Changes: changes}, nil, TransactionApplied},
+		{"nothing to do", &ApplyResult{}, nil, TransactionUnchanged},
+		{"declined", &ApplyResult{Changes: changes, Aborted: true}, nil, TransactionAborted},
+		{"pacman failed", &ApplyResult{Changes: changes}, errors.New("exit status 1"), TransactionFailed},
+	}
+
+	for _, tt := range tests {
+		if got := transactionStatus(tt.result, tt.err); got != tt.want {
+			t.Errorf("%s: transactionStatus() = %s, want %s", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestRecordTransaction(t *testing.T) {
+	ctx := context.Background()
+	db := openTestDB(t)
+	if err := migrate(ctx, db); err != nil {
+		t.Fatal(err)
+	}
+	queries := database.New(db)
+
+	info := TransactionInfo{
+		Started:     time.Now(),
+		Host:        "laptop",
+		Flags:       []string{"strict"},
+		InstallArgs: []string{"--needed"},
+	}
+	result := &ApplyResult{Changes: []Change{
+		{ActionInstall, "neovim", StatusSucceeded, "0.10.0-1"},
+		{ActionRemoveUnmanaged, "zsh", StatusFailed, ""},
+	}}
+	if err := recordTransaction(ctx, queries, info, result, errors.New("exit status 1")); err != nil {
+		t.Fatal(err)
+	}
+
+	tx, err := queries.GetTransaction(ctx, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tx.Host != "laptop" || tx.Status != TransactionFailed || tx.Error.String != "exit status 1" {
+		t.Errorf("transaction = %+v, want the failed sync of laptop", tx)
+	}
+	if got := decodeList(tx.Flags); !reflect.DeepEqual(got, info.Flags) {
+		t.Errorf("flags = %v, want %v", got, info.Flags)
+	}
+	if got := decodeList(tx.InstallArgs); !reflect.DeepEqual(got, info.InstallArgs) {
+		t.Errorf("install args = %v, want %v", got, info.InstallArgs)
+	}
+	if got := decodeList(tx.RemoveArgs); len(got) != 0 {
+		t.Errorf("remove args = %v, want none", got)
+	}
+
+	changes, err := queries.GetTransactionChanges(ctx, tx.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(changes) != 2 {
+		t.Fatalf("changes = %+v, want 2", changes)
+	}
+	if c := changes[0]; c.Action != "install" || c.Package != "neovim" || c.Status != "succeeded" || c.Version.String != "0.10.0-1" {
+		t.Errorf("changes[0] = %+v, want the install of neovim 0.10.0-1", c)
+	}
+	if c := changes[1]; c.Status != "failed" || c.Version.Valid {
+		t.Errorf("changes[1] = %+v, want a failure without a version", c)
+	}
+}
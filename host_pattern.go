@@ -0,0 +1,105 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// REGEX_PREFIX marks a hosts/ entry as a regular expression, e.g. hosts/~build-[0-9]+/
+const REGEX_PREFIX = "~"
+
+// HostMatch is how a hosts/ entry matches host names, from the least to the
+// most specific. The most specific entry wins when a "!pkg" line and a
+// declaration disagree.
+type HostMatch int
+
+const (
+	MatchRegex HostMatch = iota
+	MatchGlob
+	MatchExact
+)
+
+// hostMatchOf tells how a hosts/ entry matches host names
+func hostMatchOf(entry string) HostMatch {
+	switch {
+	case strings.HasPrefix(entry, REGEX_PREFIX):
+		return MatchRegex
+	case strings.ContainsAny(entry, "*?["):
+		return MatchGlob
+	default:
+		return MatchExact
+	}
+}
+
+func isHostPattern(entry string) bool {
+	return hostMatchOf(entry) != MatchExact
+}
+
+// validateHostEntry checks the syntax of a glob or regex hosts/ entry
+func validateHostEntry(entry string) error {
+	switch hostMatchOf(entry) {
+	case MatchRegex:
+		if _, err := hostRegexp(entry); err != nil {
+			return fmt.Errorf("invalid host regex %q: %w", entry, err)
+		}
+	case MatchGlob:
+		if _, err := path.Match(entry, ""); err != nil {
+			return fmt.Errorf("invalid host glob %q: %w", entry, err)
+		}
+	}
+	return nil
+}
+
+// hostRegexp compiles a regex hosts/ entry, anchored to the whole host name
+func hostRegexp(entry string) (*regexp.Regexp, error) {
+	return regexp.Compile("^(?:" + strings.TrimPrefix(entry, REGEX_PREFIX) + ")$")
+}
+
+// matchHost reports whether a hosts/ entry matches a host name
+func matchHost(entry, hostname string) bool {
+	switch hostMatchOf(entry) {
+	case MatchRegex:
+		re, err := hostRegexp(entry)
+		return err == nil && re.MatchString(hostname)
+	case MatchGlob:
+		ok, _ := path.Match(entry, hostname)
+		return ok
+	default:
+		return entry == hostname
+	}
+}
+
+// ambiguousHostPatterns returns the patterns matching the host that have the
+// same precedence as another matching one, sorted
+func ambiguousHostPatterns(defs []Definition, hostname string) []string {
+	byMatch := make(map[HostMatch][]string)
+	for _, def := range defs {
+		if def.Host == nil || !isHostPattern(*def.Host) || !matchHost(*def.Host, hostname) {
+			continue
+		}
+		match := hostMatchOf(*def.Host)
+		byMatch[match] = appendUnique(byMatch[match], *def.Host)
+	}
+
+	var ambiguous []string
+	for _, patterns := range byMatch {
+		if len(patterns) > 1 {
+			ambiguous = append(ambiguous, patterns...)
+		}
+	}
+	sort.Strings(ambiguous)
+	return ambiguous
+}
+
+// warnAmbiguousHostPatterns warns when several patterns of the same kind match
+// the host, since neither overrides the other's "!pkg" lines
+func warnAmbiguousHostPatterns(defs []Definition, hostname string) {
+	if patterns := ambiguousHostPatterns(defs, hostname); len(patterns) > 0 {
+		fmt.Fprintf(os.Stderr, "Warning: host patterns %s all match %s with the same precedence, exclusions between them win on a tie\n",
+			strings.Join(patterns, ", "), hostname)
+	}
+}
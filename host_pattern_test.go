@@ -0,0 +1,128 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestMatchHost(t *testing.T) {
+	tests := []struct {
+		entry, hostname string
+		want            bool
+	}{
+		{"laptop", "laptop", true},
+		{"laptop", "laptop-2", false},
+		{"build-*", "build-01", true},
+		{"build-*", "build", false},
+		{"build-0?", "build-01", true},
+		{"build-[12]*", "build-2a", true},
+		{"build-[12]*", "build-3a", false},
+		{"~build-[0-9]+", "build-01", true},
+		// Regexes match the whole host name
+		{"~build-[0-9]+", "build-01a", false},
+		{"~build|ci", "ci", true},
+		{"~build|ci", "ci-runner", false},
+		{"~build-(", "build-(", false},
+	}
+
+	for _, tt := range tests {
+		if got := matchHost(tt.entry, tt.hostname); got != tt.want {
+			t.Errorf("matchHost(%q, %q) = %v, want %v", tt.entry, tt.hostname, got, tt.want)
+		}
+	}
+}
+
+func TestValidateHostEntry(t *testing.T) {
+	for _, entry := range []string{"laptop", "build-*", "~build-[0-9]+"} {
+		if err := validateHostEntry(entry); err != nil {
+			t.Errorf("validateHostEntry(%q) = %v, want no error", entry, err)
+		}
+	}
+	for _, entry := range []string{"build-[", "~build-("} {
+		if err := validateHostEntry(entry); err == nil {
+			t.Errorf("validateHostEntry(%q) accepted an invalid pattern", entry)
+		}
+	}
+}
+
+func TestHostPatternPrecedence(t *testing.T) {
+	tests := []struct {
+		name         string
+		files        map[string]string
+		wantPackages []string
+	}{
+		{
+			name:         "exact host wins over a glob",
+			files:        map[string]string{"hosts/build-*.pkgs": "!ccache\n", "hosts/build-01.pkgs": "ccache\n"},
+			wantPackages: []string{"ccache"},
+		},
+		{
+			name:         "glob wins over a regex",
+			files:        map[string]string{"hosts/~build-[0-9]+.pkgs": "ccache\n", "hosts/build-*.pkgs": "!ccache\n"},
+			wantPackages: nil,
+		},
+		{
+			name:         "regex wins over a role",
+			files:        map[string]string{"roles/builders.pkgs": "!ccache\n", "hosts/~build-[0-9]+.pkgs": "ccache\n"},
+			wantPackages: []string{"ccache"},
+		},
+		{
+			name:         "patterns of other hosts are ignored",
+			files:        map[string]string{"base.pkgs": "ccache\n", "hosts/ci-*.pkgs": "!ccache\n"},
+			wantPackages: []string{"ccache"},
+		},
+	}
+
+	machine := Machine{Hostname: "build-01", Roles: []string{"builders"}}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			desired, _, err := buildDesiredPackagesFromDefs(loadTestDefinitions(t, tt.files), machine, noGroups{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := desiredNames(desired); !reflect.DeepEqual(got, tt.wantPackages) {
+				t.Errorf("packages = %v, want %v", got, tt.wantPackages)
+			}
+		})
+	}
+}
+
+func TestHostPatternsAreManagedForTheHost(t *testing.T) {
+	defs := loadTestDefinitions(t, map[string]string{"hosts/build-*.pkgs": "ccache\n"})
+	desired, _, err := buildDesiredPackagesFromDefs(defs, Machine{Hostname: "build-01"}, noGroups{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(desired) != 1 || !reflect.DeepEqual(desired[0].Scopes, []string{"build-01"}) {
+		t.Errorf("packages = %+v, want ccache recorded for build-01", desired)
+	}
+}
+
+func TestAmbiguousHostPatterns(t *testing.T) {
+	defs := loadTestDefinitions(t, map[string]string{
+		"hosts/build-*.pkgs":        "ccache\n",
+		"hosts/build-0?.pkgs":       "distcc\n",
+		"hosts/~build-[0-9]+.pkgs":  "mold\n",
+		"hosts/build-01.pkgs":       "htop\n",
+		"hosts/ci-*/runner.pkgs":    "docker\n",
+		"hosts/~ci-[0-9]+.pkgs":     "podman\n",
+		"hosts/~(build|ci)-01.pkgs": "git\n",
+	})
+
+	tests := []struct {
+		hostname string
+		want     []string
+	}{
+		// The exact entry is alone of its kind
+		{"build-01", []string{"build-*", "build-0?", "~(build|ci)-01", "~build-[0-9]+"}},
+		{"build-10", nil},
+		{"ci-01", []string{"~(build|ci)-01", "~ci-[0-9]+"}},
+		{"laptop", nil},
+	}
+
+	for _, tt := range tests {
+		if got := ambiguousHostPatterns(defs, tt.hostname); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("ambiguousHostPatterns(%s) = %v, want %v", tt.hostname, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,234 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ImportLayout is how "ditto import" splits packages into definition files
+type ImportLayout string
+
+const (
+	ImportByRepo   ImportLayout = "repo"
+	ImportByGroup  ImportLayout = "group"
+	ImportToSingle ImportLayout = "single"
+)
+
+const (
+	// foreignRepo holds packages no sync database provides, like AUR ones
+	foreignRepo = "foreign"
+	// ungrouped holds packages outside of any pacman group
+	ungrouped = "ungrouped"
+	// importedFile is the file name of the single layout
+	importedFile = "packages"
+)
+
+type ImportOptions struct {
+	Layout ImportLayout
+	// ForHost writes the files under hosts/ for the host instead of globally
+	ForHost bool
+	// Host is the host whose definitions are checked and files written, this machine when empty
+	Host   string
+	DryRun bool
+	// Yes writes the files without asking
+	Yes bool
+}
+
+// ImportFile is a definition file written by "ditto import"
+type ImportFile struct {
+	// File is the path relative to the packages directory
+	File     string
+	Packages []string
+	Exists   bool
+}
+
+// Import writes the explicitly installed packages the definitions do not cover yet into .pkgs files
+func Import(opts ImportOptions, appCtx *AppContext) error {
+	installed, err := appCtx.Pacman.ListInstalled()
+	if err != nil {
+		return fmt.Errorf("failed to list installed packages: %w", err)
+	}
+
+	defs, err := appCtx.PackageDef.LoadAllDefinitions()
+	if err != nil {
+		return fmt.Errorf("failed to load package definitions: %w", err)
+	}
+
+	hostname, err := currentHostname(opts.Host)
+	if err != nil {
+		return err
+	}
+
+	machine, err := newMachine(hostname, nil, appCtx)
+	if err != nil {
+		return err
+	}
+
+	desired, _, err := buildDesiredPackagesFromDefs(defs, machine, appCtx.Pacman)
+	if err != nil {
+		return fmt.Errorf("failed to resolve desired packages: %w", err)
+	}
+	covered := make(map[string]bool, len(desired))
+	for _, pkg := range resolveProviders(desired, installed) {
+		covered[pkg.Name] = true
+	}
+
+	var pkgs []InstalledPackage
+	for _, pkg := range installed {
+		if pkg.Reason == ReasonExplicit && !covered[pkg.Name] {
+			pkgs = append(pkgs, pkg)
+		}
+	}
+	if len(pkgs) == 0 {
+		fmt.Println("Every explicitly installed package is already in your definitions.")
+		return nil
+	}
+
+	files, err := planImport(pkgs, opts, hostname, appCtx)
+	if err != nil {
+		return err
+	}
+
+	printImportPreview(appCtx, files)
+
+	if opts.DryRun {
+		fmt.Println("Dry run mode — no files written")
+		return nil
+	}
+
+	if !opts.Yes {
+		ok, err := confirm(fmt.Sprintf("Write %d file(s)?", len(files)))
+		if err != nil {
+			return err
+		}
+		if !ok {
+			fmt.Println("Aborted.")
+			return nil
+		}
+	}
+
+	for _, file := range files {
+		if file.Exists {
+			if err := appendImported(file, appCtx); err != nil {
+				return fmt.Errorf("failed to append to %s: %w", file.File, err)
+			}
+			fmt.Printf("Appended %d package(s) to %s\n", len(file.Packages), file.File)
+			continue
+		}
+
+		if err := appCtx.PackageDef.WriteFile(file.File, importContent(file, hostname)); err != nil {
+			return fmt.Errorf("failed to write %s: %w", file.File, err)
+		}
+		fmt.Printf("Wrote %s\n", file.File)
+	}
+
+	return nil
+}
+
+// appendImported adds the packages at the end of an existing definition file,
+// keeping every line it already has
+func appendImported(file ImportFile, appCtx *AppContext) error {
+	df, err := appCtx.PackageDef.Open(file.File)
+	if err != nil {
+		return err
+	}
+	for _, pkg := range file.Packages {
+		df.Append(pkg)
+	}
+	return appCtx.PackageDef.Save(file.File, df)
+}
+
+// planImport splits packages into definition files following the layout
+func planImport(pkgs []InstalledPackage, opts ImportOptions, hostname string, appCtx *AppContext) ([]ImportFile, error) {
+	repos := make(map[string]string)
+	if opts.Layout == ImportByRepo {
+		available, err := appCtx.Pacman.ListAvailable()
+		if err != nil {
+			return nil, fmt.Errorf("cannot group packages by repository: %w", err)
+		}
+		for _, pkg := range available {
+			if _, ok := repos[pkg.Name]; !ok {
+				repos[pkg.Name] = pkg.Repo
+			}
+		}
+	}
+
+	byName := make(map[string][]string)
+	for _, pkg := range pkgs {
+		var name string
+		switch opts.Layout {
+		case ImportByRepo:
+			name = repos[pkg.Name]
+			if name == "" {
+				name = foreignRepo
+			}
+		case ImportByGroup:
+			name = ungrouped
+			if len(pkg.Groups) > 0 {
+				name = slices.Min(pkg.Groups)
+			}
+		default:
+			name = importedFile
+		}
+		byName[name] = append(byName[name], pkg.Name)
+	}
+
+	files := make([]ImportFile, 0, len(byName))
+	for name, names := range byName {
+		file := name + FILE_EXTENSION
+		if opts.ForHost {
+			// A single file is hosts/<hostname>.pkgs, the others go in hosts/<hostname>/
+			inHostDir := file
+			if opts.Layout == ImportToSingle {
+				inHostDir = ""
+			}
+			target, err := definitionTarget(inHostDir, hostname)
+			if err != nil {
+				return nil, err
+			}
+			file = target
+		}
+
+		sort.Strings(names)
+		files = append(files, ImportFile{
+			File:     file,
+			Packages: names,
+			Exists:   appCtx.PackageDef.Exists(file),
+		})
+	}
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].File < files[j].File
+	})
+
+	return files, nil
+}
+
+func printImportPreview(appCtx *AppContext, files []ImportFile) {
+	var out bytes.Buffer
+	for _, file := range files {
+		status := "new"
+		if file.Exists {
+			status = "exists, appended to"
+		}
+		fmt.Fprintf(&out, "%s (%d packages, %s)\n", file.File, len(file.Packages), status)
+		for _, pkg := range file.Packages {
+			fmt.Fprintf(&out, "  %s\n", pkg)
+		}
+		out.WriteString("\n")
+	}
+	displayWithOptionalPager(appCtx, &out)
+}
+
+func importContent(file ImportFile, hostname string) []byte {
+	var b strings.Builder
+	fmt.Fprintf(&b, "# Imported from %s on %s\n", hostname, time.Now().Format(time.DateOnly))
+	for _, pkg := range file.Packages {
+		b.WriteString(pkg)
+		b.WriteString("\n")
+	}
+	return []byte(b.String())
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestImportAppendsToExistingFiles(t *testing.T) {
+	appCtx := newTestAppContext(t, "testdata/import")
+
+	opts := ImportOptions{Layout: ImportToSingle, ForHost: true, Host: "test-host", Yes: true}
+	if err := Import(opts, appCtx); err != nil {
+		t.Fatal(err)
+	}
+
+	// zsh is already declared, man-db is the other explicit package of the fixture
+	data, err := os.ReadFile(filepath.Join(appCtx.PackageDef.path, "hosts", "test-host.pkgs"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := string(data), "# Shells\nzsh # login shell\nman-db\n"; got != want {
+		t.Errorf("hosts/test-host.pkgs = %q, want %q", got, want)
+	}
+}
+
+func TestImportWritesNewFiles(t *testing.T) {
+	appCtx := newTestAppContext(t, "")
+
+	if err := Import(ImportOptions{Layout: ImportByGroup, Host: "test-host", Yes: true}, appCtx); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := os.ReadFile(filepath.Join(appCtx.PackageDef.path, "ungrouped.pkgs"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(string(data), "# Imported from test-host on ") || !strings.HasSuffix(string(data), "\nman-db\nzsh\n") {
+		t.Errorf("ungrouped.pkgs = %q, want man-db and zsh under an import comment", data)
+	}
+}
+
+func TestPlanImport(t *testing.T) {
+	appCtx := newTestAppContext(t, "testdata/import")
+	appCtx.Pacman.syncDB = NewSyncDB(t.TempDir())
+	writeSyncDB(t, appCtx.Pacman.syncDB.root, "core", false)
+	writeSyncDB(t, appCtx.Pacman.syncDB.root, "extra", false)
+
+	pkgs := []InstalledPackage{
+		{Name: "bash", Groups: []string{"base"}},
+		{Name: "neovim"},
+		{Name: "yay", Groups: []string{"aur", "helpers"}},
+	}
+
+	tests := []struct {
+		name string
+		opts ImportOptions
+		want []ImportFile
+	}{
+		{
+			name: "by repo",
+			opts: ImportOptions{Layout: ImportByRepo},
+			want: []ImportFile{
+				{File: "core.pkgs", Packages: []string{"bash"}},
+				{File: "extra.pkgs", Packages: []string{"neovim"}},
+				{File: "foreign.pkgs", Packages: []string{"yay"}},
+			},
+		},
+		{
+			name: "by group",
+			opts: ImportOptions{Layout: ImportByGroup},
+			want: []ImportFile{
+				{File: "aur.pkgs", Packages: []string{"yay"}},
+				{File: "base.pkgs", Packages: []string{"bash"}},
+				{File: "ungrouped.pkgs", Packages: []string{"neovim"}},
+			},
+		},
+		{
+			name: "single",
+			opts: ImportOptions{Layout: ImportToSingle},
+			want: []ImportFile{{File: "packages.pkgs", Packages: []string{"bash", "neovim", "yay"}}},
+		},
+		{
+			name: "single for the host",
+			opts: ImportOptions{Layout: ImportToSingle, ForHost: true},
+			want: []ImportFile{{File: "hosts/test-host.pkgs", Packages: []string{"bash", "neovim", "yay"}, Exists: true}},
+		},
+		{
+			name: "by group for the host",
+			opts: ImportOptions{Layout: ImportByGroup, ForHost: true},
+			want: []ImportFile{
+				{File: "hosts/test-host/aur.pkgs", Packages: []string{"yay"}},
+				{File: "hosts/test-host/base.pkgs", Packages: []string{"bash"}},
+				{File: "hosts/test-host/ungrouped.pkgs", Packages: []string{"neovim"}},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			files, err := planImport(pkgs, tt.opts, "test-host", appCtx)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(files, tt.want) {
+				t.Errorf("planImport() = %+v, want %+v", files, tt.want)
+			}
+		})
+	}
+
+	if _, err := planImport(pkgs, ImportOptions{Layout: ImportToSingle, ForHost: true}, "../etc", appCtx); err == nil {
+		t.Error("planImport() accepted a host name outside of hosts/")
+	}
+}
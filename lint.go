@@ -0,0 +1,500 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// LintSeverity tells whether a lint issue fails the lint or is only reported
+type LintSeverity string
+
+const (
+	LintError   LintSeverity = "error"
+	LintWarning LintSeverity = "warning"
+)
+
+// Lint rules, reported with every issue so they can be told apart in scripts
+const (
+	RuleSyntax        = "syntax"
+	RuleExtension     = "extension"
+	RuleName          = "name"
+	RuleEmpty         = "empty"
+	RuleDuplicate     = "duplicate"
+	RuleGlobalAndHost = "global-and-host"
+	RuleUnknownHost   = "unknown-host"
+	RuleUnknownRole   = "unknown-role"
+	RuleAmbiguousHost = "ambiguous-host"
+	RuleRedundantDep  = "redundant-dependency"
+)
+
+const (
+	lintFormatVersion  = 1
+	unknownHostMessage = "no known host matches %q, add it to knownHosts in the config if it has never synced"
+	unknownRoleMessage = "no host has the role %q, assign it in the config or in a hosts/<hostname>.roles file"
+)
+
+// LintIssue is a problem found in the definitions. Line is 0 when the issue
+// is about a whole file or directory.
+type LintIssue struct {
+	File     string       `json:"file" yaml:"file"`
+	Line     int          `json:"line,omitempty" yaml:"line,omitempty"`
+	Severity LintSeverity `json:"severity" yaml:"severity"`
+	Rule     string       `json:"rule" yaml:"rule"`
+	Message  string       `json:"message" yaml:"message"`
+}
+
+func (i LintIssue) String() string {
+	location := i.File
+	if i.Line > 0 {
+		location = fmt.Sprintf("%s:%d", i.File, i.Line)
+	}
+	return fmt.Sprintf("%s: %s: %s [%s]", location, i.Severity, i.Message, i.Rule)
+}
+
+// LintReport is what "ditto lint --output json" prints
+type LintReport struct {
+	FormatVersion int         `json:"format_version" yaml:"format_version"`
+	Errors        int         `json:"errors" yaml:"errors"`
+	Warnings      int         `json:"warnings" yaml:"warnings"`
+	Issues        []LintIssue `json:"issues" yaml:"issues"`
+}
+
+type LintOptions struct {
+	Output OutputFormat
+	// Strict fails on warnings too
+	Strict bool
+}
+
+// Lint checks every definition file, for all hosts, and reports all the problems at once
+func Lint(opts LintOptions, appCtx *AppContext) error {
+	report := LintReport{FormatVersion: lintFormatVersion, Issues: []LintIssue{}}
+
+	issues, err := lintIssues(appCtx)
+	if err != nil {
+		return err
+	}
+	report.Issues = append(report.Issues, issues...)
+	for _, issue := range report.Issues {
+		if issue.Severity == LintError {
+			report.Errors++
+		} else {
+			report.Warnings++
+		}
+	}
+
+	if opts.Output.Structured() {
+		if err := writeReport(os.Stdout, opts.Output, report); err != nil {
+			return err
+		}
+	} else {
+		for _, issue := range report.Issues {
+			fmt.Println(issue)
+		}
+		if len(report.Issues) == 0 {
+			fmt.Println("No problems found in the definitions.")
+		}
+	}
+
+	if report.Errors > 0 || (opts.Strict && report.Warnings > 0) {
+		return fmt.Errorf("%d error(s) and %d warning(s) found in the definitions", report.Errors, report.Warnings)
+	}
+	return nil
+}
+
+// lintIssues runs every check on the definitions, sorted by file and line
+func lintIssues(appCtx *AppContext) ([]LintIssue, error) {
+	hostRoles, err := appCtx.PackageDef.AllHostRoles(appCtx.Config)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read host roles: %w", err)
+	}
+
+	known := knownHosts(appCtx)
+	defs, issues, err := lintFiles(appCtx, known, hostRoles)
+	if err != nil {
+		return nil, err
+	}
+	issues = append(issues, lintHostPatterns(defs, known)...)
+	issues = append(issues, lintDefinitions(defs, hostRoles, lintDependencies(appCtx))...)
+
+	sort.SliceStable(issues, func(i, j int) bool {
+		if issues[i].File != issues[j].File {
+			return issues[i].File < issues[j].File
+		}
+		return issues[i].Line < issues[j].Line
+	})
+	return issues, nil
+}
+
+// lintFiles parses every definition file and reports the problems that are
+// local to a file or directory
+func lintFiles(appCtx *AppContext, known map[string]bool, hostRoles map[string][]string) ([]Definition, []LintIssue, error) {
+	pd := appCtx.PackageDef
+	knownRoles := make(map[string]bool)
+	for _, roles := range hostRoles {
+		for _, role := range roles {
+			knownRoles[role] = true
+		}
+	}
+
+	var defs []Definition
+	var issues []LintIssue
+	err := filepath.WalkDir(pd.path, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+
+		relPath, err := filepath.Rel(pd.path, path)
+		if err != nil {
+			return err
+		}
+		if relPath == "." {
+			return nil
+		}
+		if strings.HasPrefix(d.Name(), ".") {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		parts := strings.Split(relPath, string(os.PathSeparator))
+		if len(parts) == 2 {
+			// Entries of hosts/ and roles/ name a host or a role
+			name := parts[1]
+			if !d.IsDir() {
+				name = strings.TrimSuffix(strings.TrimSuffix(name, FILE_EXTENSION), ROLES_EXTENSION)
+			}
+			file := relPath
+			if d.IsDir() {
+				file += string(os.PathSeparator)
+			}
+
+			switch {
+			case parts[0] == "hosts" && !matchesKnownHost(name, known):
+				issues = append(issues, LintIssue{
+					File:     file,
+					Severity: LintWarning,
+					Rule:     RuleUnknownHost,
+					Message:  fmt.Sprintf(unknownHostMessage, name),
+				})
+			case parts[0] == "roles" && !knownRoles[name]:
+				issues = append(issues, LintIssue{
+					File:     file,
+					Severity: LintWarning,
+					Rule:     RuleUnknownRole,
+					Message:  fmt.Sprintf(unknownRoleMessage, name),
+				})
+			}
+		}
+		if d.IsDir() || (len(parts) == 2 && parts[0] == "hosts" && strings.HasSuffix(relPath, ROLES_EXTENSION)) {
+			return nil
+		}
+
+		if !strings.HasSuffix(relPath, FILE_EXTENSION) {
+			issues = append(issues, LintIssue{
+				File:     relPath,
+				Severity: LintError,
+				Rule:     RuleExtension,
+				Message:  fmt.Sprintf("not a %s file, ditto ignores it", FILE_EXTENSION),
+			})
+			return nil
+		}
+
+		def, err := pd.parseDefFile(path)
+		issues = append(issues, parseIssues(relPath, err)...)
+		if def.File == "" {
+			return nil
+		}
+		if def.IsEmpty() && err == nil {
+			issues = append(issues, LintIssue{
+				File:     relPath,
+				Severity: LintWarning,
+				Rule:     RuleEmpty,
+				Message:  "no packages defined",
+			})
+		}
+		defs = append(defs, def)
+		return nil
+	})
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read package definitions: %w", err)
+	}
+
+	return defs, issues, nil
+}
+
+// parseIssues turns the error of parseDefFile into one issue per invalid line
+func parseIssues(file string, err error) []LintIssue {
+	if err == nil {
+		return nil
+	}
+
+	errs := []error{err}
+	if joined, ok := err.(interface{ Unwrap() []error }); ok {
+		errs = joined.Unwrap()
+	}
+
+	var issues []LintIssue
+	for _, err := range errs {
+		issue := LintIssue{File: file, Severity: LintError, Rule: RuleSyntax, Message: err.Error()}
+		var parseErr *ParseError
+		if errors.As(err, &parseErr) {
+			issue.Line = parseErr.Line
+			issue.Message = parseErr.Err.Error()
+		}
+		issues = append(issues, issue)
+	}
+	return issues
+}
+
+// lintHostPatterns reports the host patterns matching a known host along with
+// another pattern of the same precedence
+func lintHostPatterns(defs []Definition, known map[string]bool) []LintIssue {
+	// Issues are reported on the first file of each pattern
+	files := make(map[string]string)
+	for _, def := range defs {
+		if def.Host == nil {
+			continue
+		}
+		if _, ok := files[*def.Host]; !ok {
+			files[*def.Host] = def.File
+		}
+	}
+
+	var issues []LintIssue
+	reported := make(map[string]bool)
+	for _, host := range slices.Sorted(maps.Keys(known)) {
+		patterns := ambiguousHostPatterns(defs, host)
+		for _, pattern := range patterns {
+			if reported[pattern] {
+				continue
+			}
+			reported[pattern] = true
+
+			others := slices.DeleteFunc(slices.Clone(patterns), func(p string) bool { return p == pattern })
+			issues = append(issues, LintIssue{
+				File:     files[pattern],
+				Severity: LintWarning,
+				Rule:     RuleAmbiguousHost,
+				Message:  fmt.Sprintf("%s matches %s with the same precedence as %s", pattern, host, strings.Join(others, ", ")),
+			})
+		}
+	}
+	return issues
+}
+
+// matchesKnownHost reports whether a hosts/ entry matches one of the known hosts
+func matchesKnownHost(entry string, known map[string]bool) bool {
+	for host := range known {
+		if matchHost(entry, host) {
+			return true
+		}
+	}
+	return false
+}
+
+// knownHosts returns the current host, every host ditto has a record of and
+// the ones listed in the config
+func knownHosts(appCtx *AppContext) map[string]bool {
+	known := make(map[string]bool)
+	if hostname, err := currentHostname(""); err == nil {
+		known[hostname] = true
+	}
+	for _, host := range appCtx.Config.KnownHosts {
+		known[host] = true
+	}
+
+	hosts, err := appCtx.QueryClient.ListKnownHosts(context.Background())
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: cannot list the hosts from the history: %v\n", err)
+	}
+	for _, host := range hosts {
+		known[host] = true
+	}
+	return known
+}
+
+// lintDependencies returns the direct dependencies of every package, from the
+// installed packages or else the sync databases
+func lintDependencies(appCtx *AppContext) map[string][]string {
+	depends := make(map[string][]string)
+
+	if available, err := appCtx.Pacman.ListAvailable(); err == nil {
+		for _, pkg := range available {
+			depends[pkg.Name] = pkg.Depends
+		}
+	} else {
+		fmt.Fprintf(os.Stderr, "Warning: dependencies of packages that are not installed are not checked: %v\n", err)
+	}
+
+	if installed, err := appCtx.Pacman.ListInstalled(); err == nil {
+		for _, pkg := range installed {
+			depends[pkg.Name] = pkg.Depends
+		}
+	} else {
+		fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+	}
+
+	return depends
+}
+
+// lintDefinitions reports the problems that involve entries of several lines or files
+func lintDefinitions(defs []Definition, hostRoles map[string][]string, depends map[string][]string) []LintIssue {
+	overlap := func(a, b string) bool {
+		return scopesOverlap(a, b, hostRoles)
+	}
+
+	type declaration struct {
+		source PackageSource
+		scope  string
+		when   Conditions
+	}
+
+	var issues []LintIssue
+	declared := make(map[string][]declaration)
+	for _, def := range defs {
+		for _, group := range def.Groups {
+			for _, name := range append([]string{group.Name}, group.Exclude...) {
+				if !validName.MatchString(name) {
+					issues = append(issues, LintIssue{
+						File:     def.File,
+						Line:     group.Line,
+						Severity: LintError,
+						Rule:     RuleName,
+						Message:  fmt.Sprintf("invalid group or package name %q", name),
+					})
+				}
+			}
+		}
+
+		for _, pkg := range def.Excludes {
+			if !validName.MatchString(pkg.Name) {
+				issues = append(issues, LintIssue{
+					File:     def.File,
+					Line:     pkg.Line,
+					Severity: LintError,
+					Rule:     RuleName,
+					Message:  fmt.Sprintf("invalid excluded package name %q", pkg.Name),
+				})
+			}
+		}
+
+		for _, pkg := range def.Packages {
+			source := PackageSource{File: def.File, Line: pkg.Line}
+			if !validName.MatchString(pkg.Name) {
+				issues = append(issues, LintIssue{
+					File:     def.File,
+					Line:     pkg.Line,
+					Severity: LintError,
+					Rule:     RuleName,
+					Message:  fmt.Sprintf("invalid package name %q", pkg.Name),
+				})
+			}
+
+			for _, other := range declared[pkg.Name] {
+				if !overlap(other.scope, def.Scope()) || other.when.Excludes(pkg.When) {
+					continue
+				}
+				issue := LintIssue{
+					File:     def.File,
+					Line:     pkg.Line,
+					Severity: LintWarning,
+					Rule:     RuleDuplicate,
+					Message:  fmt.Sprintf("%s is already declared in %s", pkg.Name, other.source),
+				}
+				if other.scope != def.Scope() {
+					issue.Rule = RuleGlobalAndHost
+					issue.Message = fmt.Sprintf("%s is also declared in %s, for %s", pkg.Name, other.source, scopeLabel(other.scope))
+				}
+				issues = append(issues, issue)
+				break
+			}
+			declared[pkg.Name] = append(declared[pkg.Name], declaration{source, def.Scope(), pkg.When})
+		}
+	}
+
+	// A package is redundant when another one depends on it wherever it is listed
+	redundant := make(map[PackageSource]bool)
+	for _, def := range defs {
+		for _, pkg := range def.Packages {
+			for _, dep := range depends[pkg.Name] {
+				for _, other := range declared[dep] {
+					if redundant[other.source] || !scopeCovers(def.Scope(), other.scope, hostRoles) || !pkg.When.Within(other.when) {
+						continue
+					}
+					redundant[other.source] = true
+					issues = append(issues, LintIssue{
+						File:     other.source.File,
+						Line:     other.source.Line,
+						Severity: LintWarning,
+						Rule:     RuleRedundantDep,
+						Message:  fmt.Sprintf("%s is already a dependency of %s (%s:%d)", dep, pkg.Name, def.File, pkg.Line),
+					})
+				}
+			}
+		}
+	}
+
+	return issues
+}
+
+// scopesOverlap reports whether some host gets the packages of both scopes
+func scopesOverlap(a, b string, hostRoles map[string][]string) bool {
+	if a == b || a == globalScope || b == globalScope {
+		return true
+	}
+	// Any host can enable a profile
+	if strings.HasPrefix(a, profilePrefix) || strings.HasPrefix(b, profilePrefix) {
+		return true
+	}
+
+	machines := []Machine{{Hostname: a, Roles: hostRoles[a]}, {Hostname: b, Roles: hostRoles[b]}}
+	for host, roles := range hostRoles {
+		machines = append(machines, Machine{Hostname: host, Roles: roles})
+	}
+	return slices.ContainsFunc(machines, func(m Machine) bool {
+		return m.Covers(a) && m.Covers(b)
+	})
+}
+
+// scopeCovers reports whether every host getting the packages of inner also
+// gets the ones of outer. Hosts matching a pattern and hosts enabling a
+// profile can't be listed, so those scopes are only covered by themselves
+// and the global one.
+func scopeCovers(outer, inner string, hostRoles map[string][]string) bool {
+	if outer == inner || outer == globalScope {
+		return true
+	}
+	if inner == globalScope || strings.HasPrefix(outer, profilePrefix) || strings.HasPrefix(inner, profilePrefix) {
+		return false
+	}
+
+	if role, ok := strings.CutPrefix(inner, rolePrefix); ok {
+		covered := false
+		for host, roles := range hostRoles {
+			if !slices.Contains(roles, role) {
+				continue
+			}
+			if !(Machine{Hostname: host, Roles: roles}).Covers(outer) {
+				return false
+			}
+			covered = true
+		}
+		return covered
+	}
+	if isHostPattern(inner) {
+		return false
+	}
+	return Machine{Hostname: inner, Roles: hostRoles[inner]}.Covers(outer)
+}
@@ -0,0 +1,174 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+// TestLintIssues lints testdata/lint, which has one problem of each kind, on
+// test-host, that has the role laptops from hosts/test-host.roles
+func TestLintIssues(t *testing.T) {
+	t.Setenv(hostEnv, "test-host")
+	appCtx := newTestAppContext(t, "testdata/lint")
+	appCtx.Config.KnownHosts = []string{"build-01"}
+	appCtx.Config.Roles = map[string][]string{"build-01": {"builders"}}
+
+	issues, err := lintIssues(appCtx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	type found struct {
+		File string
+		Line int
+		Rule string
+	}
+	var got []found
+	for _, issue := range issues {
+		got = append(got, found{issue.File, issue.Line, issue.Rule})
+	}
+
+	tests := []struct {
+		name string
+		want found
+	}{
+		{"invalid package name", found{"base.pkgs", 5, RuleName}},
+		{"dependency of another package", found{"base.pkgs", 4, RuleRedundantDep}},
+		{"unbalanced [end]", found{"broken.pkgs", 2, RuleSyntax}},
+		{"same package twice for all hosts", found{"dev.pkgs", 1, RuleDuplicate}},
+		{"file without packages", found{"empty.pkgs", 0, RuleEmpty}},
+		{"host pattern with the same precedence", found{"hosts/*-host.pkgs", 0, RuleAmbiguousHost}},
+		{"other host pattern with the same precedence", found{"hosts/test-*.pkgs", 0, RuleAmbiguousHost}},
+		{"host never synced", found{"hosts/ghost.pkgs", 0, RuleUnknownHost}},
+		{"not a definition file", found{"notes.txt", 0, RuleExtension}},
+		{"global package in a profile", found{"profiles/gaming/games.pkgs", 1, RuleGlobalAndHost}},
+		{"host package in a role of the host", found{"roles/laptops.pkgs", 1, RuleGlobalAndHost}},
+		{"role of no host", found{"roles/servers.pkgs", 0, RuleUnknownRole}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, issue := range got {
+				if issue == tt.want {
+					return
+				}
+			}
+			t.Errorf("no %s issue at %s:%d", tt.want.Rule, tt.want.File, tt.want.Line)
+		})
+	}
+
+	// Nothing else: exclusive conditions, .roles files, roles from the
+	// config and known hosts are fine
+	if len(got) != len(tests) {
+		t.Errorf("%d issues, want %d: %+v", len(got), len(tests), issues)
+	}
+}
+
+func TestLintDefinitionsConditions(t *testing.T) {
+	amd := Condition{Fact: "cpu.vendor", Value: "amd"}
+	laptop := Condition{Fact: "laptop", Value: "true"}
+	defs := []Definition{
+		{File: "base.pkgs", Packages: []PackageEntry{{Name: "linux-firmware", Line: 1, When: Conditions{amd}}}},
+		{File: "amd.pkgs", Packages: []PackageEntry{{Name: "linux-firmware", Line: 1, When: Conditions{amd.Not()}}}},
+		{File: "laptop.pkgs", Packages: []PackageEntry{{Name: "linux-firmware", Line: 1, When: Conditions{laptop}}}},
+	}
+
+	issues := lintDefinitions(defs, nil, nil)
+	// Only the entry that can hold along with the first one is reported
+	if len(issues) != 1 || issues[0].File != "laptop.pkgs" || issues[0].Rule != RuleDuplicate {
+		t.Errorf("lintDefinitions() = %+v, want a duplicate in laptop.pkgs", issues)
+	}
+}
+
+func TestScopesOverlap(t *testing.T) {
+	hostRoles := map[string][]string{
+		"laptop":   {"portable"},
+		"build-01": {"builders"},
+	}
+
+	tests := []struct {
+		a, b string
+		want bool
+	}{
+		{globalScope, "laptop", true},
+		{"laptop", "laptop", true},
+		{"laptop", "tower", false},
+		{"role:portable", "laptop", true},
+		{"role:portable", "tower", false},
+		{"role:portable", "role:builders", false},
+		{"build-*", "build-01", true},
+		{"build-*", "role:builders", true},
+		{"build-*", "~build-[0-9]+", true},
+		{"build-*", "laptop", false},
+		{"~build-[0-9]+", "role:portable", false},
+		{"profile:gaming", "tower", true},
+		{"profile:gaming", "role:builders", true},
+	}
+
+	for _, tt := range tests {
+		if got := scopesOverlap(tt.a, tt.b, hostRoles); got != tt.want {
+			t.Errorf("scopesOverlap(%q, %q) = %v, want %v", tt.a, tt.b, got, tt.want)
+		}
+		if got := scopesOverlap(tt.b, tt.a, hostRoles); got != tt.want {
+			t.Errorf("scopesOverlap(%q, %q) = %v, want %v", tt.b, tt.a, got, tt.want)
+		}
+	}
+}
+
+func TestScopeCovers(t *testing.T) {
+	hostRoles := map[string][]string{
+		"laptop":   {"portable", "desktop"},
+		"tablet":   {"portable"},
+		"build-01": {"builders"},
+	}
+
+	tests := []struct {
+		outer, inner string
+		want         bool
+	}{
+		{globalScope, "laptop", true},
+		{globalScope, "profile:gaming", true},
+		{"laptop", globalScope, false},
+		{"laptop", "laptop", true},
+		{"role:portable", "laptop", true},
+		{"role:portable", "tower", false},
+		// Every host with the role has the other one
+		{"role:portable", "role:desktop", true},
+		{"role:desktop", "role:portable", false},
+		// A role of no host covers nothing
+		{"laptop", "role:servers", false},
+		{"build-*", "build-01", true},
+		{"~build-[0-9]+", "build-01", true},
+		{"build-*", "role:builders", true},
+		{"build-*", "build-?", false},
+		{"build-*", "build-*", true},
+		{"profile:gaming", "laptop", false},
+		{"laptop", "profile:gaming", false},
+		{"profile:gaming", "profile:gaming", true},
+	}
+
+	for _, tt := range tests {
+		if got := scopeCovers(tt.outer, tt.inner, hostRoles); got != tt.want {
+			t.Errorf("scopeCovers(%q, %q) = %v, want %v", tt.outer, tt.inner, got, tt.want)
+		}
+	}
+}
+
+func TestLintHostPatterns(t *testing.T) {
+	host := func(entry string) *string { return &entry }
+	defs := []Definition{
+		{File: "hosts/build-*.pkgs", Host: host("build-*")},
+		{File: "hosts/build-?1.pkgs", Host: host("build-?1")},
+		{File: "hosts/~build-[0-9]+.pkgs", Host: host("~build-[0-9]+")},
+		{File: "hosts/build-01.pkgs", Host: host("build-01")},
+	}
+
+	issues := lintHostPatterns(defs, map[string]bool{"build-01": true, "build-02": true})
+	var files []string
+	for _, issue := range issues {
+		files = append(files, issue.File)
+	}
+	// The regex and the exact entry are alone of their kind
+	if want := []string{"hosts/build-*.pkgs", "hosts/build-?1.pkgs"}; !reflect.DeepEqual(files, want) {
+		t.Errorf("lintHostPatterns() reported %v, want %v", files, want)
+	}
+}
@@ -0,0 +1,193 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// LocalDB reads the local pacman database (<dbpath>/local/<pkg>-<ver>/desc)
+// without spawning pacman
+type LocalDB struct {
+	root string
+}
+
+func NewLocalDB(root string) *LocalDB {
+	return &LocalDB{root: root}
+}
+
+// Packages returns every installed package, with RequiredBy and OptionalFor
+// computed from the depends of the other installed packages
+func (db *LocalDB) Packages() ([]InstalledPackage, error) {
+	localPath := filepath.Join(db.root, "local")
+	entries, err := os.ReadDir(localPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read local database: %w", err)
+	}
+
+	pkgs := make([]InstalledPackage, 0, len(entries))
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+
+		descPath := filepath.Join(localPath, entry.Name(), "desc")
+		pkg, err := readLocalDesc(descPath)
+		if err != nil {
+			return nil, err
+		}
+		pkgs = append(pkgs, pkg)
+	}
+
+	sort.Slice(pkgs, func(i, j int) bool {
+		return pkgs[i].Name < pkgs[j].Name
+	})
+	computeReverseDeps(pkgs)
+
+	return pkgs, nil
+}
+
+// GroupMembers returns the installed packages belonging to a group
+func (db *LocalDB) GroupMembers(group string) ([]string, error) {
+	pkgs, err := db.Packages()
+	if err != nil {
+		return nil, err
+	}
+
+	var members []string
+	for _, pkg := range pkgs {
+		if slices.Contains(pkg.Groups, group) {
+			members = append(members, pkg.Name)
+		}
+	}
+	return members, nil
+}
+
+func readLocalDesc(path string) (InstalledPackage, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return InstalledPackage{}, err
+	}
+	defer f.Close()
+
+	fields, err := parseDesc(f)
+	if err != nil {
+		return InstalledPackage{}, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+
+	pkg := InstalledPackage{
+		Name:        firstValue(fields["NAME"]),
+		Version:     firstValue(fields["VERSION"]),
+		Description: firstValue(fields["DESC"]),
+		Groups:      fields["GROUPS"],
+		Provides:    depNames(fields["PROVIDES"]),
+		Replaces:    depNames(fields["REPLACES"]),
+		Depends:     depNames(fields["DEPENDS"]),
+		OptDepends:  depNames(fields["OPTDEPENDS"]),
+		InstallDate: time.Unix(parseInt(fields["INSTALLDATE"]), 0),
+		Size:        parseInt(fields["SIZE"]),
+	}
+	if pkg.Name == "" {
+		return InstalledPackage{}, fmt.Errorf("missing %%NAME%% in %s", path)
+	}
+
+	// A missing %REASON% means the package was explicitly installed
+	if firstValue(fields["REASON"]) == "1" {
+		pkg.Reason = ReasonDependency
+	}
+
+	return pkg, nil
+}
+
+// parseDesc parses the "%KEY%" blocks used by pacman desc files.
+// Each block is followed by one value per line and ends at a blank line.
+func parseDesc(r io.Reader) (map[string][]string, error) {
+	fields := make(map[string][]string)
+	scanner := bufio.NewScanner(r)
+
+	var key string
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		switch {
+		case line == "":
+			key = ""
+		case key == "" && strings.HasPrefix(line, "%") && strings.HasSuffix(line, "%"):
+			key = strings.Trim(line, "%")
+			fields[key] = nil
+		case key != "":
+			fields[key] = append(fields[key], line)
+		}
+	}
+
+	return fields, scanner.Err()
+}
+
+// computeReverseDeps fills RequiredBy and OptionalFor, matching dependencies
+// against package names and provides like pacman does
+func computeReverseDeps(pkgs []InstalledPackage) {
+	satisfiers := make(map[string][]int)
+	for i, pkg := range pkgs {
+		satisfiers[pkg.Name] = append(satisfiers[pkg.Name], i)
+		for _, name := range pkg.Provides {
+			if name != pkg.Name {
+				satisfiers[name] = append(satisfiers[name], i)
+			}
+		}
+	}
+
+	for _, pkg := range pkgs {
+		for _, dep := range pkg.Depends {
+			for _, i := range satisfiers[dep] {
+				pkgs[i].RequiredBy = appendUnique(pkgs[i].RequiredBy, pkg.Name)
+			}
+		}
+		for _, dep := range pkg.OptDepends {
+			for _, i := range satisfiers[dep] {
+				pkgs[i].OptionalFor = appendUnique(pkgs[i].OptionalFor, pkg.Name)
+			}
+		}
+	}
+}
+
+// depNames strips version constraints and optdepends descriptions,
+// turning "sh=5.2", "libfoo.so>=1" or "python: for scripts" into bare names
+func depNames(values []string) []string {
+	if len(values) == 0 {
+		return nil
+	}
+
+	names := make([]string, 0, len(values))
+	for _, value := range values {
+		if idx := strings.IndexAny(value, "<>=:"); idx != -1 {
+			value = value[:idx]
+		}
+		names = append(names, strings.TrimSpace(value))
+	}
+	return names
+}
+
+func firstValue(values []string) string {
+	if len(values) == 0 {
+		return ""
+	}
+	return values[0]
+}
+
+func parseInt(values []string) int64 {
+	n, _ := strconv.ParseInt(firstValue(values), 10, 64)
+	return n
+}
+
+func appendUnique(values []string, value string) []string {
+	if slices.Contains(values, value) {
+		return values
+	}
+	return append(values, value)
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseDesc(t *testing.T) {
+	desc := `%NAME%
+bash
+
+%DEPENDS%
+readline
+  glibc
+
+%EMPTY%
+
+stray line
+%REASON%
+1
+`
+	fields, err := parseDesc(strings.NewReader(desc))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string][]string{
+		"NAME":    {"bash"},
+		"DEPENDS": {"readline", "glibc"},
+		"EMPTY":   nil,
+		"REASON":  {"1"},
+	}
+	if !reflect.DeepEqual(fields, want) {
+		t.Errorf("parseDesc() = %v, want %v", fields, want)
+	}
+}
+
+func TestReadLocalDesc(t *testing.T) {
+	pkg, err := readLocalDesc("testdata/pacman/local/bash-5.2.026-2/desc")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := InstalledPackage{
+		Name:        "bash",
+		Version:     "5.2.026-2",
+		Description: "The GNU Bourne Again shell",
+		Reason:      ReasonDependency,
+		InstallDate: time.Unix(1700000000, 0),
+		Size:        9463429,
+		Groups:      []string{"base"},
+		Provides:    []string{"sh"},
+		Depends:     []string{"readline", "libreadline.so", "glibc", "ncurses"},
+		OptDepends:  []string{"bash-completion"},
+	}
+	if !reflect.DeepEqual(pkg, want) {
+		t.Errorf("readLocalDesc() = %+v, want %+v", pkg, want)
+	}
+}
+
+func TestReadLocalDescWithoutReasonIsExplicit(t *testing.T) {
+	pkg, err := readLocalDesc("testdata/pacman/local/zsh-5.9-5/desc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pkg.Reason != ReasonExplicit {
+		t.Errorf("Reason = %v, want ReasonExplicit", pkg.Reason)
+	}
+}
+
+func TestReadLocalDescWithoutName(t *testing.T) {
+	_, err := readLocalDesc("testdata/pacman/broken/desc")
+	if err == nil || !strings.Contains(err.Error(), "missing %NAME%") {
+		t.Errorf("readLocalDesc() error = %v, want a missing %%NAME%% error", err)
+	}
+}
+
+func TestLocalDBPackages(t *testing.T) {
+	pkgs, err := NewLocalDB("testdata/pacman").Packages()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var names []string
+	for _, pkg := range pkgs {
+		names = append(names, pkg.Name)
+	}
+	if want := []string{"bash", "groff", "man-db", "zsh"}; !reflect.DeepEqual(names, want) {
+		t.Fatalf("Packages() names = %v, want %v", names, want)
+	}
+
+	// bash is required by man-db by name and by zsh through its provides,
+	// and optional for groff
+	bash := pkgs[0]
+	if want := []string{"man-db", "zsh"}; !reflect.DeepEqual(bash.RequiredBy, want) {
+		t.Errorf("bash RequiredBy = %v, want %v", bash.RequiredBy, want)
+	}
+	if want := []string{"groff"}; !reflect.DeepEqual(bash.OptionalFor, want) {
+		t.Errorf("bash OptionalFor = %v, want %v", bash.OptionalFor, want)
+	}
+	if groff := pkgs[1]; !reflect.DeepEqual(groff.RequiredBy, []string{"man-db"}) {
+		t.Errorf("groff RequiredBy = %v, want [man-db]", groff.RequiredBy)
+	}
+}
+
+func TestComputeReverseDeps(t *testing.T) {
+	pkgs := []InstalledPackage{
+		{Name: "a", Depends: []string{"b", "sh", "b"}},
+		{Name: "b", Provides: []string{"b", "sh"}},
+		{Name: "c", Depends: []string{"missing"}, OptDepends: []string{"sh"}},
+	}
+	computeReverseDeps(pkgs)
+
+	if want := []string{"a"}; !reflect.DeepEqual(pkgs[1].RequiredBy, want) {
+		t.Errorf("b RequiredBy = %v, want %v", pkgs[1].RequiredBy, want)
+	}
+	if want := []string{"c"}; !reflect.DeepEqual(pkgs[1].OptionalFor, want) {
+		t.Errorf("b OptionalFor = %v, want %v", pkgs[1].OptionalFor, want)
+	}
+	if pkgs[0].RequiredBy != nil || pkgs[2].RequiredBy != nil {
+		t.Errorf("unexpected RequiredBy: a = %v, c = %v", pkgs[0].RequiredBy, pkgs[2].RequiredBy)
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"log"
 	"os"
+	"strconv"
 
 	"github.com/ony-boom/ditto/database"
 	"github.com/urfave/cli/v3"
@@ -39,6 +40,22 @@ By the way, just running 'ditto' will create the config file at <XDG_CONFIG_HOME
 `,
 		Commands: []*cli.Command{
 			newSyncCommand(appCtx),
+			newStatusCommand(appCtx),
+			newCheckCommand(appCtx),
+			newValidateCommand(appCtx),
+			newLintCommand(appCtx),
+			newFmtCommand(appCtx),
+			newHistoryCommand(appCtx),
+			newRollbackCommand(appCtx),
+			newPlanCommand(appCtx),
+			newApplyCommand(appCtx),
+			newImportCommand(appCtx),
+			newAddCommand(appCtx),
+			newRmCommand(appCtx),
+			newWhichCommand(appCtx),
+			newResolveCommand(appCtx),
+			newFactsCommand(appCtx),
+			newProfileCommand(appCtx),
 		},
 	}
 
@@ -73,6 +90,16 @@ Examples:
 				Aliases: []string{"x"},
 				Usage:   "Enable strict mode: remove packages not in the desired list.",
 			},
+			newOutputFlag(),
+			newYesFlag(),
+			newConfirmEachFlag(),
+			&cli.BoolFlag{
+				Name:    "interactive",
+				Aliases: []string{"i"},
+				Usage:   "Review the changes in a full-screen view and pick the ones to apply.",
+			},
+			newHostFlag(),
+			newProfileFlag(),
 		},
 		Action: func(ctx context.Context, cmd *cli.Command) error {
 			return syncAction(appCtx, cmd)
@@ -80,6 +107,58 @@ Examples:
 	}
 }
 
+// newOutputFlag is the --output flag of the commands that show a diff
+func newOutputFlag() *cli.StringFlag {
+	return &cli.StringFlag{
+		Name:    "output",
+		Aliases: []string{"o"},
+		Value:   string(OutputTable),
+		Usage:   "Print the changes as `FORMAT`: table, json or yaml.",
+	}
+}
+
+// newHostFlag is the --host flag of the commands resolving the definitions for a host
+func newHostFlag() *cli.StringFlag {
+	return &cli.StringFlag{
+		Name:  "host",
+		Usage: "Resolve the definitions for `HOST` instead of this machine (default: $" + hostEnv + " or the hostname).",
+	}
+}
+
+// newProfileFlag is the --profile flag of the commands that can enable profiles for one run
+func newProfileFlag() *cli.StringSliceFlag {
+	return &cli.StringSliceFlag{
+		Name:    "profile",
+		Aliases: []string{"p"},
+		Usage:   "Also load the definitions of profiles/`NAME`/ for this run, on top of the profiles enabled for the host.",
+	}
+}
+
+func newYesFlag() *cli.BoolFlag {
+	return &cli.BoolFlag{
+		Name:    "yes",
+		Aliases: []string{"y"},
+		Usage:   "Apply the changes without asking for confirmation.",
+	}
+}
+
+func newConfirmEachFlag() *cli.BoolFlag {
+	return &cli.BoolFlag{
+		Name:  "confirm-each",
+		Usage: "Ask for every change separately, to apply only some of them.",
+	}
+}
+
+// confirmOptions reads --yes and --confirm-each. The assumeYes config key
+// applies unless --confirm-each is given.
+func confirmOptions(cmd *cli.Command, cfg *Config) (yes, confirmEach bool, err error) {
+	yes, confirmEach = cmd.Bool("yes"), cmd.Bool("confirm-each")
+	if yes && confirmEach {
+		return false, false, fmt.Errorf("--yes and --confirm-each cannot be used together")
+	}
+	return yes || (cfg.AssumeYes && !confirmEach), confirmEach, nil
+}
+
 func syncAction(appCtx *AppContext, cmd *cli.Command) error {
 	installArgs, removeArgs := splitInstallRemoveArgs(cmd.Args().Slice())
 
@@ -88,14 +167,109 @@ func syncAction(appCtx *AppContext, cmd *cli.Command) error {
 		removeArgs = nil
 	}
 
+	output, err := parseOutputFormat(cmd.String("output"))
+	if err != nil {
+		return err
+	}
+
+	yes, confirmEach, err := confirmOptions(cmd, appCtx.Config)
+	if err != nil {
+		return err
+	}
+
+	interactive := cmd.Bool("interactive")
+	if interactive && (cmd.Bool("yes") || confirmEach || output.Structured()) {
+		return fmt.Errorf("--interactive cannot be combined with --yes, --confirm-each or structured output")
+	}
+
 	return Sync(SyncOptions{
 		Strict:      cmd.Bool("strict"),
 		DryRun:      cmd.Bool("dry-run"),
 		InstallArgs: installArgs,
 		RemoveArgs:  removeArgs,
+		Output:      output,
+		Yes:         yes && !interactive,
+		ConfirmEach: confirmEach,
+		Interactive: interactive,
+		Host:        cmd.String("host"),
+		Profiles:    cmd.StringSlice("profile"),
 	}, appCtx)
 }
 
+func newStatusCommand(appCtx *AppContext) *cli.Command {
+	return &cli.Command{
+		Name:    "status",
+		Usage:   "Show what a sync would change",
+		Aliases: []string{"diff"},
+		Description: `Status compares your desired package list with what's currently installed
+and lists the changes 'ditto sync' would make, without applying anything.
+
+Use --output json or --output yaml to read the changes from a script.`,
+		Flags: []cli.Flag{
+			&cli.BoolFlag{
+				Name:    "strict",
+				Aliases: []string{"x"},
+				Usage:   "Include the changes strict mode would make.",
+			},
+			newOutputFlag(),
+			newHostFlag(),
+			newProfileFlag(),
+		},
+		Action: func(ctx context.Context, cmd *cli.Command) error {
+			output, err := parseOutputFormat(cmd.String("output"))
+			if err != nil {
+				return err
+			}
+			return Status(SyncOptions{
+				Strict:   cmd.Bool("strict"),
+				Output:   output,
+				Host:     cmd.String("host"),
+				Profiles: cmd.StringSlice("profile"),
+			}, appCtx)
+		},
+	}
+}
+
+func newCheckCommand(appCtx *AppContext) *cli.Command {
+	return &cli.Command{
+		Name:  "check",
+		Usage: "Detect drift between your definitions and the system, for cron and monitoring",
+		Description: `Check computes the same changes as 'ditto sync' but never applies them nor prompts.
+A one-line summary is printed to stderr and the exit code tells what drifted:
+
+  0  the system is in sync
+  1  an error occurred
+  2  desired packages are missing
+  4  unmanaged packages are present (6 when packages are missing as well)
+
+With --strict, unlisted explicit packages count as unmanaged and listed packages
+installed only as dependencies count as missing.`,
+		Flags: []cli.Flag{
+			&cli.BoolFlag{
+				Name:    "strict",
+				Aliases: []string{"x"},
+				Usage:   "Check against strict mode.",
+			},
+			newHostFlag(),
+			newProfileFlag(),
+		},
+		Action: func(ctx context.Context, cmd *cli.Command) error {
+			code, err := Check(SyncOptions{
+				Strict:   cmd.Bool("strict"),
+				Host:     cmd.String("host"),
+				Profiles: cmd.StringSlice("profile"),
+			}, appCtx)
+			if err != nil {
+				return err
+			}
+			if code != CheckInSync {
+				return cli.Exit("", code)
+			}
+			return nil
+		},
+	}
+}
+
 func splitInstallRemoveArgs(args []string) (installArgs, removeArgs []string) {
 	for i, a := range args {
 		if a == "::" {
@@ -104,3 +278,475 @@ func splitInstallRemoveArgs(args []string) (installArgs, removeArgs []string) {
 	}
 	return args, nil
 }
+
+func newValidateCommand(appCtx *AppContext) *cli.Command {
+	return &cli.Command{
+		Name:  "validate",
+		Usage: "Check that every package in your definitions exists in a configured repository",
+		Description: `Validate reads the pacman sync databases and reports every package or group
+from your definitions that no repository provides, with "did you mean" suggestions.
+Definitions for all hosts are checked. Run 'pacman -Sy' first if the databases are missing.`,
+		Action: func(ctx context.Context, cmd *cli.Command) error {
+			return validateAction(appCtx)
+		},
+	}
+}
+
+func newLintCommand(appCtx *AppContext) *cli.Command {
+	output := newOutputFlag()
+	output.Usage = "Print the issues as `FORMAT`: table, json or yaml."
+
+	return &cli.Command{
+		Name:  "lint",
+		Usage: "Report every problem in your definitions, for all hosts",
+		Description: `Lint checks every file under packages/ and reports each problem with its file and line:
+syntax errors, invalid package names, files without the .pkgs extension, empty files,
+packages declared twice or both globally and for a host, packages already pulled in as
+dependencies of other listed packages, and hosts/ entries matching no known host.
+
+Known hosts are this machine, the hosts in ditto's history and the knownHosts config key.
+Lint exits with 1 when it finds errors, or warnings too with --strict, so it can run
+from a pre-commit hook.`,
+		Flags: []cli.Flag{
+			output,
+			&cli.BoolFlag{
+				Name:  "strict",
+				Usage: "Fail on warnings too.",
+			},
+		},
+		Action: func(ctx context.Context, cmd *cli.Command) error {
+			format, err := parseOutputFormat(cmd.String("output"))
+			if err != nil {
+				return err
+			}
+			return Lint(LintOptions{Output: format, Strict: cmd.Bool("strict")}, appCtx)
+		},
+	}
+}
+
+func newFmtCommand(appCtx *AppContext) *cli.Command {
+	return &cli.Command{
+		Name:      "fmt",
+		Usage:     "Rewrite .pkgs files in canonical form",
+		ArgsUsage: "[FILE...]",
+		Description: `Fmt sorts the entries of every section (delimited by comments or blank lines),
+removes duplicates, aligns inline comments and normalizes whitespace. Comments are kept,
+the inline comments of removed duplicates are moved to the remaining entry.
+
+Without arguments, every definition file is formatted. With --check, nothing is written:
+a diff of the files that are not formatted is printed and ditto exits with 1.`,
+		Flags: []cli.Flag{
+			&cli.BoolFlag{
+				Name:  "check",
+				Usage: "Print a diff and fail when files are not formatted, without writing them.",
+			},
+		},
+		Action: func(ctx context.Context, cmd *cli.Command) error {
+			return Fmt(cmd.Args().Slice(), FmtOptions{Check: cmd.Bool("check")}, appCtx)
+		},
+	}
+}
+
+func validateAction(appCtx *AppContext) error {
+	defs, err := appCtx.PackageDef.LoadAllDefinitions()
+	if err != nil {
+		return fmt.Errorf("failed to load package definitions: %w", err)
+	}
+
+	available, err := appCtx.Pacman.ListAvailable()
+	if err != nil {
+		return err
+	}
+
+	installed, err := appCtx.Pacman.ListInstalled()
+	if err != nil {
+		return err
+	}
+
+	issues := validateDefinitions(defs, available, installed)
+	for _, issue := range issues {
+		fmt.Println(issue)
+	}
+
+	if len(issues) > 0 {
+		return fmt.Errorf("%d name(s) not found in any configured repository", len(issues))
+	}
+
+	fmt.Println("All definitions are valid.")
+	return nil
+}
+
+func newHistoryCommand(appCtx *AppContext) *cli.Command {
+	return &cli.Command{
+		Name:  "history",
+		Usage: "List previous syncs",
+		Description: `History lists the syncs ditto ran, newest first, with their outcome.
+Use 'ditto history show <id>' to see every change of a sync.`,
+		Flags: []cli.Flag{
+			&cli.IntFlag{
+				Name:    "limit",
+				Aliases: []string{"l"},
+				Value:   20,
+				Usage:   "Maximum number of syncs to list.",
+			},
+		},
+		Action: func(ctx context.Context, cmd *cli.Command) error {
+			return historyListAction(ctx, appCtx, int64(cmd.Int("limit")))
+		},
+		Commands: []*cli.Command{
+			{
+				Name:      "show",
+				Usage:     "Show the details of a sync",
+				ArgsUsage: "<id>",
+				Action: func(ctx context.Context, cmd *cli.Command) error {
+					id, err := strconv.ParseInt(cmd.Args().First(), 10, 64)
+					if err != nil {
+						return fmt.Errorf("invalid sync id %q", cmd.Args().First())
+					}
+					return historyShowAction(ctx, appCtx, id)
+				},
+			},
+		},
+	}
+}
+
+func newRollbackCommand(appCtx *AppContext) *cli.Command {
+	return &cli.Command{
+		Name:      "rollback",
+		Usage:     "Undo a previous sync",
+		ArgsUsage: "[<id>]",
+		Description: `Rollback reinstalls what a sync removed and removes what it installed.
+Removed packages are reinstalled from the pacman cache at their exact version when available.
+Without an id, the latest sync of the host is rolled back, a sync of another host is refused. See 'ditto history' for ids.`,
+		Flags: []cli.Flag{
+			&cli.BoolFlag{
+				Name:    "dry-run",
+				Aliases: []string{"n"},
+				Usage:   "Show the rollback without making changes.",
+			},
+			newYesFlag(),
+			newHostFlag(),
+		},
+		Action: func(ctx context.Context, cmd *cli.Command) error {
+			var id int64
+			if cmd.Args().Present() {
+				var err error
+				id, err = strconv.ParseInt(cmd.Args().First(), 10, 64)
+				if err != nil {
+					return fmt.Errorf("invalid sync id %q", cmd.Args().First())
+				}
+			}
+			return Rollback(RollbackOptions{
+				TransactionID: id,
+				Host:          cmd.String("host"),
+				DryRun:        cmd.Bool("dry-run"),
+				Yes:           cmd.Bool("yes") || appCtx.Config.AssumeYes,
+			}, appCtx)
+		},
+	}
+}
+
+func newPlanCommand(appCtx *AppContext) *cli.Command {
+	return &cli.Command{
+		Name:      "plan",
+		Usage:     "Compute a sync and save it to be applied later",
+		ArgsUsage: "[pacman install args...] :: [pacman remove args...]",
+		Description: `Plan computes the same changes as 'ditto sync' without applying them.
+With -o, the plan is saved as JSON along with a hash of your definitions and installed
+packages, so 'ditto apply' can run it later and refuse if anything drifted.
+
+Examples:
+  ditto plan --strict -o plan.json -- --needed
+  ditto apply plan.json`,
+		Flags: []cli.Flag{
+			&cli.BoolFlag{
+				Name:    "strict",
+				Aliases: []string{"x"},
+				Usage:   "Enable strict mode: remove packages not in the desired list.",
+			},
+			&cli.StringFlag{
+				Name:    "output",
+				Aliases: []string{"o"},
+				Usage:   "Write the plan as JSON to `FILE` ('-' for stdout).",
+			},
+			newHostFlag(),
+			newProfileFlag(),
+		},
+		Action: func(ctx context.Context, cmd *cli.Command) error {
+			installArgs, removeArgs := splitInstallRemoveArgs(cmd.Args().Slice())
+			if len(removeArgs) > 0 && !cmd.Bool("strict") {
+				fmt.Fprintln(os.Stderr, "Warning: remove args provided but --strict is disabled, ignoring them.")
+				removeArgs = nil
+			}
+
+			return PlanSync(SyncOptions{
+				Strict:      cmd.Bool("strict"),
+				InstallArgs: installArgs,
+				RemoveArgs:  removeArgs,
+				Host:        cmd.String("host"),
+				Profiles:    cmd.StringSlice("profile"),
+			}, cmd.String("output"), appCtx)
+		},
+	}
+}
+
+func newApplyCommand(appCtx *AppContext) *cli.Command {
+	return &cli.Command{
+		Name:      "apply",
+		Usage:     "Apply a plan saved by 'ditto plan'",
+		ArgsUsage: "<planfile>",
+		Description: `Apply executes exactly the changes of a plan file. It refuses to run when
+your definitions or installed packages changed since the plan was made.`,
+		Flags: []cli.Flag{
+			newYesFlag(),
+			newConfirmEachFlag(),
+			newHostFlag(),
+		},
+		Action: func(ctx context.Context, cmd *cli.Command) error {
+			if !cmd.Args().Present() {
+				return fmt.Errorf("missing plan file")
+			}
+			yes, confirmEach, err := confirmOptions(cmd, appCtx.Config)
+			if err != nil {
+				return err
+			}
+			return ApplyPlan(cmd.Args().First(), SyncOptions{Yes: yes, ConfirmEach: confirmEach, Host: cmd.String("host")}, appCtx)
+		},
+	}
+}
+
+func newImportCommand(appCtx *AppContext) *cli.Command {
+	return &cli.Command{
+		Name:  "import",
+		Usage: "Write the explicitly installed packages into .pkgs files",
+		Description: `Import captures the current system: every explicitly installed package that your
+definitions do not cover yet is written into .pkgs files under the packages directory.
+
+Packages are split by repository (core.pkgs, extra.pkgs, multilib.pkgs, foreign.pkgs for AUR
+and local packages), by pacman group, or into a single packages.pkgs. With --for-host, files go
+under hosts/<hostname>/ (or hosts/<hostname>.pkgs for a single file) instead.
+
+The files are previewed first, and packages going to an existing file are appended to it.`,
+		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:  "by",
+				Value: string(ImportByRepo),
+				Usage: "Split packages by `LAYOUT`: repo, group or single.",
+			},
+			&cli.BoolFlag{
+				Name:  "for-host",
+				Usage: "Write the files under hosts/ for the host only.",
+			},
+			newHostFlag(),
+			&cli.BoolFlag{
+				Name:    "dry-run",
+				Aliases: []string{"n"},
+				Usage:   "Preview the files without writing them.",
+			},
+			&cli.BoolFlag{
+				Name:    "yes",
+				Aliases: []string{"y"},
+				Usage:   "Write new files without asking. Existing files are skipped.",
+			},
+		},
+		Action: func(ctx context.Context, cmd *cli.Command) error {
+			layout := ImportLayout(cmd.String("by"))
+			switch layout {
+			case ImportByRepo, ImportByGroup, ImportToSingle:
+			default:
+				return fmt.Errorf("unknown layout %q, expected repo, group or single", layout)
+			}
+
+			return Import(ImportOptions{
+				Layout:  layout,
+				ForHost: cmd.Bool("for-host"),
+				Host:    cmd.String("host"),
+				DryRun:  cmd.Bool("dry-run"),
+				Yes:     cmd.Bool("yes"),
+			}, appCtx)
+		},
+	}
+}
+
+func newAddCommand(appCtx *AppContext) *cli.Command {
+	return &cli.Command{
+		Name:      "add",
+		Usage:     "Add packages to a definition file",
+		ArgsUsage: "<package>...",
+		Description: `Add appends packages to a .pkgs file, keeping its comments and ordering.
+Only package names are accepted. Packages already declared for the same hosts,
+by name or through a group, are skipped.
+
+Examples:
+  ditto add neovim ripgrep --file dev.pkgs
+  ditto add steam --host laptop             # hosts/laptop.pkgs
+  ditto add steam --host laptop --file gaming --install`,
+		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:    "file",
+				Aliases: []string{"f"},
+				Usage:   "Definition `FILE` to add to, relative to the packages directory.",
+			},
+			&cli.StringFlag{
+				Name:  "host",
+				Usage: "Add to the definitions of `HOST` only.",
+			},
+			&cli.BoolFlag{
+				Name:  "install",
+				Usage: "Install the added packages right away.",
+			},
+		},
+		Action: func(ctx context.Context, cmd *cli.Command) error {
+			if !cmd.Args().Present() {
+				return fmt.Errorf("missing package names")
+			}
+			return AddPackages(cmd.Args().Slice(), AddOptions{
+				File:    cmd.String("file"),
+				Host:    cmd.String("host"),
+				Install: cmd.Bool("install"),
+			}, appCtx)
+		},
+	}
+}
+
+func newRmCommand(appCtx *AppContext) *cli.Command {
+	return &cli.Command{
+		Name:      "rm",
+		Usage:     "Remove packages from every definition file declaring them",
+		ArgsUsage: "<package>...",
+		Description: `Rm deletes the lines declaring the packages from all .pkgs files, keeping
+everything else as is. Without --uninstall, the packages are removed by the next sync.`,
+		Flags: []cli.Flag{
+			&cli.BoolFlag{
+				Name:  "uninstall",
+				Usage: "Uninstall the removed packages right away.",
+			},
+		},
+		Action: func(ctx context.Context, cmd *cli.Command) error {
+			if !cmd.Args().Present() {
+				return fmt.Errorf("missing package names")
+			}
+			return RemovePackages(cmd.Args().Slice(), cmd.Bool("uninstall"), appCtx)
+		},
+	}
+}
+
+func newFactsCommand(appCtx *AppContext) *cli.Command {
+	output := newOutputFlag()
+	output.Usage = "Print the facts as `FORMAT`: table, json or yaml."
+
+	return &cli.Command{
+		Name:  "facts",
+		Usage: "Print the machine facts [if] blocks can test",
+		Description: `Facts are detected from /proc/cpuinfo, /sys/class/drm, /sys/class/dmi/id,
+/sys/class/power_supply and the usual container and hypervisor hints, under the
+factsRoot directory of the config ("/" by default). Definition files can gate lines on them:
+
+  [if cpu.vendor == "amd"]
+  amd-ucode
+  [else]
+  intel-ucode
+  [end]`,
+		Flags: []cli.Flag{output},
+		Action: func(ctx context.Context, cmd *cli.Command) error {
+			format, err := parseOutputFormat(cmd.String("output"))
+			if err != nil {
+				return err
+			}
+			return PrintFacts(FactsOptions{Output: format}, appCtx)
+		},
+	}
+}
+
+func newResolveCommand(appCtx *AppContext) *cli.Command {
+	output := newOutputFlag()
+	output.Usage = "Print the packages as `FORMAT`: table, json or yaml."
+
+	return &cli.Command{
+		Name:  "resolve",
+		Usage: "Print the effective package list of a host",
+		Description: `Resolve prints every package the definitions request for a host, after groups,
+roles, host patterns and "!pkg" exclusions, and whether each one comes from a global,
+role or host-specific file. Installed packages are not looked at, so any host can be
+resolved from any machine.
+
+Example:
+  ditto resolve --host build-01`,
+		Flags: []cli.Flag{
+			newHostFlag(),
+			newProfileFlag(),
+			output,
+		},
+		Action: func(ctx context.Context, cmd *cli.Command) error {
+			format, err := parseOutputFormat(cmd.String("output"))
+			if err != nil {
+				return err
+			}
+			return Resolve(ResolveOptions{
+				Host:     cmd.String("host"),
+				Profiles: cmd.StringSlice("profile"),
+				Output:   format,
+			}, appCtx)
+		},
+	}
+}
+
+func newWhichCommand(appCtx *AppContext) *cli.Command {
+	return &cli.Command{
+		Name:      "which",
+		Usage:     "Show which definition files declare a package",
+		ArgsUsage: "<package>",
+		Description: `Which lists every line declaring a package, directly or through a "@group",
+with the hosts it is scoped to and whether it applies to this host.`,
+		Flags: []cli.Flag{
+			newHostFlag(),
+		},
+		Action: func(ctx context.Context, cmd *cli.Command) error {
+			if !cmd.Args().Present() {
+				return fmt.Errorf("missing package name")
+			}
+			return Which(cmd.Args().First(), cmd.String("host"), appCtx)
+		},
+	}
+}
+
+func newProfileCommand(appCtx *AppContext) *cli.Command {
+	return &cli.Command{
+		Name:  "profile",
+		Usage: "List, enable or disable profiles",
+		Description: `Profiles are package sets under profiles/<name>/ that only apply when enabled,
+whatever the host: for one run with --profile on sync, status, check, plan and resolve,
+or for every sync of a host with 'ditto profile enable'. Once a profile is disabled,
+its packages are removed on the next sync like any package dropped from the definitions.`,
+		Flags: []cli.Flag{
+			newHostFlag(),
+		},
+		Action: func(ctx context.Context, cmd *cli.Command) error {
+			return ListProfiles(cmd.String("host"), appCtx)
+		},
+		Commands: []*cli.Command{
+			{
+				Name:      "enable",
+				Usage:     "Load profiles on every sync of the host",
+				ArgsUsage: "<profile>...",
+				Flags: []cli.Flag{
+					newHostFlag(),
+				},
+				Action: func(ctx context.Context, cmd *cli.Command) error {
+					return EnableProfiles(cmd.Args().Slice(), cmd.String("host"), appCtx)
+				},
+			},
+			{
+				Name:      "disable",
+				Usage:     "Stop loading profiles, their packages are removed on the next sync",
+				ArgsUsage: "<profile>...",
+				Flags: []cli.Flag{
+					newHostFlag(),
+				},
+				Action: func(ctx context.Context, cmd *cli.Command) error {
+					return DisableProfiles(cmd.Args().Slice(), cmd.String("host"), appCtx)
+				},
+			},
+		},
+	}
+}
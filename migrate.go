@@ -0,0 +1,100 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"fmt"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// Migrations are named "<version>_<description>.sql" and applied in version order.
+// sqlc reads the same directory as its schema.
+//
+//go:embed migrations/*.sql
+var migrations embed.FS
+
+const schemaVersionDDL = `CREATE TABLE IF NOT EXISTS schema_version (
+    version INTEGER PRIMARY KEY,
+    applied_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+)`
+
+type migration struct {
+	version int
+	name    string
+	sql     string
+}
+
+// migrate upgrades the database in place, applying every embedded migration
+// newer than the latest version recorded in schema_version
+func migrate(ctx context.Context, db *sql.DB) error {
+	if _, err := db.ExecContext(ctx, schemaVersionDDL); err != nil {
+		return fmt.Errorf("failed to create schema_version table: %w", err)
+	}
+
+	var current int
+	if err := db.QueryRowContext(ctx, "SELECT IFNULL(MAX(version), 0) FROM schema_version").Scan(&current); err != nil {
+		return fmt.Errorf("failed to read schema version: %w", err)
+	}
+
+	pending, err := loadMigrations(current)
+	if err != nil {
+		return err
+	}
+
+	for _, m := range pending {
+		if err := applyMigration(ctx, db, m); err != nil {
+			return fmt.Errorf("migration %s failed: %w", m.name, err)
+		}
+	}
+
+	return nil
+}
+
+// loadMigrations returns the embedded migrations newer than the given version
+func loadMigrations(after int) ([]migration, error) {
+	entries, err := migrations.ReadDir("migrations")
+	if err != nil {
+		return nil, err
+	}
+
+	// ReadDir returns entries sorted by filename, hence by version
+	var pending []migration
+	for _, entry := range entries {
+		prefix, _, _ := strings.Cut(entry.Name(), "_")
+		version, err := strconv.Atoi(prefix)
+		if err != nil {
+			return nil, fmt.Errorf("invalid migration name %s: %w", entry.Name(), err)
+		}
+		if version <= after {
+			continue
+		}
+
+		data, err := migrations.ReadFile(path.Join("migrations", entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+		pending = append(pending, migration{version: version, name: entry.Name(), sql: string(data)})
+	}
+
+	return pending, nil
+}
+
+func applyMigration(ctx context.Context, db *sql.DB, m migration) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, m.sql); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, "INSERT INTO schema_version (version) VALUES (?)", m.version); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/ony-boom/ditto/database"
+)
+
+func openTestDB(t *testing.T) *sql.DB {
+	t.Helper()
+	db, err := sql.Open("sqlite", filepath.Join(t.TempDir(), "ditto.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+// migrateTo applies the migrations up to version, like an older ditto would have
+func migrateTo(t *testing.T, db *sql.DB, version int) {
+	t.Helper()
+	ctx := context.Background()
+	if _, err := db.ExecContext(ctx, schemaVersionDDL); err != nil {
+		t.Fatal(err)
+	}
+	pending, err := loadMigrations(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, m := range pending {
+		if m.version > version {
+			break
+		}
+		if err := applyMigration(ctx, db, m); err != nil {
+			t.Fatalf("migration %s failed: %v", m.name, err)
+		}
+	}
+}
+
+func schemaVersion(t *testing.T, db *sql.DB) int {
+	t.Helper()
+	var version int
+	if err := db.QueryRow("SELECT MAX(version) FROM schema_version").Scan(&version); err != nil {
+		t.Fatal(err)
+	}
+	return version
+}
+
+func TestLoadMigrations(t *testing.T) {
+	all, err := loadMigrations(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, m := range all {
+		if m.version != i+1 {
+			t.Errorf("migration %s has version %d, want %d", m.name, m.version, i+1)
+		}
+	}
+
+	pending, err := loadMigrations(len(all) - 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pending) != 1 || pending[0].version != len(all) {
+		t.Errorf("loadMigrations(%d) = %+v, want the latest migration only", len(all)-1, pending)
+	}
+}
+
+func TestMigrate(t *testing.T) {
+	ctx := context.Background()
+	db := openTestDB(t)
+
+	if err := migrate(ctx, db); err != nil {
+		t.Fatal(err)
+	}
+	all, err := loadMigrations(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := schemaVersion(t, db); got != len(all) {
+		t.Errorf("schema version = %d, want %d", got, len(all))
+	}
+
+	// Running it again is a no-op
+	if err := migrate(ctx, db); err != nil {
+		t.Fatal(err)
+	}
+	var applied int
+	if err := db.QueryRow("SELECT COUNT(*) FROM schema_version").Scan(&applied); err != nil {
+		t.Fatal(err)
+	}
+	if applied != len(all) {
+		t.Errorf("%d versions recorded, want %d", applied, len(all))
+	}
+
+	// The generated queries work on the migrated schema
+	queries := database.New(db)
+	if _, err := queries.CreatePackage(ctx, database.CreatePackageParams{Host: "laptop", Scope: globalScope, Name: "git"}); err != nil {
+		t.Fatal(err)
+	}
+	pkgs, err := queries.GetPackagesByHost(ctx, "laptop")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pkgs) != 1 || pkgs[0].Name != "git" {
+		t.Errorf("GetPackagesByHost() = %+v, want git", pkgs)
+	}
+}
+
+func TestMigrateScopesPackagesByManagingHost(t *testing.T) {
+	db := openTestDB(t)
+	migrateTo(t, db, 1)
+
+	_, err := db.Exec(`
+		INSERT INTO packages (host, name) VALUES (NULL, 'git'), ('', 'vim'), ('laptop', 'tlp'), ('tower', 'htop');
+	`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := migrate(context.Background(), db); err != nil {
+		t.Fatal(err)
+	}
+
+	rows, err := db.Query("SELECT host, scope, name FROM packages ORDER BY host, scope, name")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+	var got [][3]string
+	for rows.Next() {
+		var row [3]string
+		if err := rows.Scan(&row[0], &row[1], &row[2]); err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, row)
+	}
+	if err := rows.Err(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Global packages are copied to every host that has packages of its own
+	want := [][3]string{
+		{"laptop", "", "git"},
+		{"laptop", "", "vim"},
+		{"laptop", "laptop", "tlp"},
+		{"tower", "", "git"},
+		{"tower", "", "vim"},
+		{"tower", "tower", "htop"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("packages = %v, want %v", got, want)
+	}
+}
+
+func TestMigrateKeepsGlobalPackagesWithoutKnownHosts(t *testing.T) {
+	db := openTestDB(t)
+	migrateTo(t, db, 1)
+
+	if _, err := db.Exec("INSERT INTO packages (host, name) VALUES (NULL, 'git')"); err != nil {
+		t.Fatal(err)
+	}
+	if err := migrate(context.Background(), db); err != nil {
+		t.Fatal(err)
+	}
+
+	var host, scope, name string
+	if err := db.QueryRow("SELECT host, scope, name FROM packages").Scan(&host, &scope, &name); err != nil {
+		t.Fatal(err)
+	}
+	if host != unclaimedHost || scope != globalScope || name != "git" {
+		t.Errorf("package = (%q, %q, %q), want git left unclaimed", host, scope, name)
+	}
+}
@@ -0,0 +1,55 @@
+-- Packages were unique by name, so the same package could not be recorded for
+-- several hosts or for both a host and the global scope. Rebuild the table keyed
+-- on the host that manages each package and the scope of the definition that
+-- declared it: the host itself for host definitions, empty for global ones.
+CREATE TABLE packages_new (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    host TEXT NOT NULL DEFAULT '',
+    scope TEXT NOT NULL DEFAULT '',
+    name TEXT NOT NULL,
+    UNIQUE (host, scope, name)
+);
+
+-- Host records were only ever written by the host itself
+INSERT OR IGNORE INTO
+    packages_new (host, scope, name)
+SELECT
+    host,
+    host,
+    name
+FROM
+    packages
+WHERE
+    IFNULL(host, '') != '';
+
+-- Global records are copied to every host that has records of its own
+INSERT OR IGNORE INTO
+    packages_new (host, scope, name)
+SELECT
+    hosts.host,
+    '',
+    packages.name
+FROM
+    packages
+    JOIN (
+        SELECT DISTINCT host FROM packages WHERE IFNULL(host, '') != ''
+    ) hosts
+WHERE
+    IFNULL(packages.host, '') = '';
+
+-- Without any known host, they stay unclaimed for each host to adopt on its first sync
+INSERT OR IGNORE INTO
+    packages_new (host, scope, name)
+SELECT
+    '',
+    '',
+    name
+FROM
+    packages
+WHERE
+    IFNULL(host, '') = ''
+    AND NOT EXISTS (SELECT 1 FROM packages WHERE IFNULL(host, '') != '');
+
+DROP TABLE packages;
+
+ALTER TABLE packages_new RENAME TO packages;
@@ -0,0 +1,23 @@
+-- Every sync is recorded as a transaction holding its planned changes
+-- and the outcome of each of them.
+CREATE TABLE transactions (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    started_at TIMESTAMP NOT NULL,
+    duration_ms INTEGER NOT NULL DEFAULT 0,
+    host TEXT NOT NULL,
+    flags TEXT NOT NULL DEFAULT '[]',
+    install_args TEXT NOT NULL DEFAULT '[]',
+    remove_args TEXT NOT NULL DEFAULT '[]',
+    status TEXT NOT NULL,
+    error TEXT
+);
+
+CREATE TABLE transaction_changes (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    transaction_id INTEGER NOT NULL REFERENCES transactions (id) ON DELETE CASCADE,
+    action TEXT NOT NULL,
+    package TEXT NOT NULL,
+    status TEXT NOT NULL
+);
+
+CREATE INDEX transaction_changes_transaction_id ON transaction_changes (transaction_id);
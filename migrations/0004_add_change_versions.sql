@@ -0,0 +1,3 @@
+-- Remember the package version each change touched, so a sync can be rolled back
+-- by reinstalling the exact version it removed.
+ALTER TABLE transaction_changes ADD COLUMN version TEXT;
@@ -0,0 +1,7 @@
+-- Profiles enabled on a host with "ditto profile enable", loaded on every sync
+-- of the host until disabled.
+CREATE TABLE host_profiles (
+    host TEXT NOT NULL,
+    profile TEXT NOT NULL,
+    PRIMARY KEY (host, profile)
+);
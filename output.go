@@ -0,0 +1,159 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+
+	"gopkg.in/yaml.v3"
+)
+
+// OutputFormat is how a command prints its results
+type OutputFormat string
+
+const (
+	OutputTable OutputFormat = "table"
+	OutputJSON  OutputFormat = "json"
+	OutputYAML  OutputFormat = "yaml"
+)
+
+func parseOutputFormat(value string) (OutputFormat, error) {
+	switch format := OutputFormat(value); format {
+	case OutputTable, OutputJSON, OutputYAML:
+		return format, nil
+	default:
+		return "", fmt.Errorf("unknown output format %q, expected table, json or yaml", value)
+	}
+}
+
+// Structured reports whether the output is meant for other programs
+func (f OutputFormat) Structured() bool {
+	return f == OutputJSON || f == OutputYAML
+}
+
+// reportFormatVersion is bumped whenever the report layout changes incompatibly
+const reportFormatVersion = 1
+
+// ReportPlanned is the status of a report whose changes were not applied
+const ReportPlanned = "planned"
+
+// SyncReport is the structured output of sync and status
+type SyncReport struct {
+	FormatVersion int    `json:"format_version" yaml:"format_version"`
+	Host          string `json:"host" yaml:"host"`
+	Strict        bool   `json:"strict" yaml:"strict"`
+	DryRun        bool   `json:"dry_run" yaml:"dry_run"`
+	// Status is a transaction status once applied, ReportPlanned before
+	Status  string         `json:"status" yaml:"status"`
+	Error   *string        `json:"error" yaml:"error"`
+	Changes []ReportChange `json:"changes" yaml:"changes"`
+}
+
+// ReportChange is a change of a sync and, once applied, its outcome
+type ReportChange struct {
+	Action  ChangeAction    `json:"action" yaml:"action"`
+	Package string          `json:"package" yaml:"package"`
+	Reason  string          `json:"reason" yaml:"reason"`
+	Sources []PackageSource `json:"sources" yaml:"sources"`
+	Host    string          `json:"host" yaml:"host"`
+	Status  ChangeStatus    `json:"status" yaml:"status"`
+	Version string          `json:"version,omitempty" yaml:"version,omitempty"`
+}
+
+func newSyncReport(state *SyncState, opts SyncOptions) SyncReport {
+	report := SyncReport{
+		FormatVersion: reportFormatVersion,
+		Host:          state.Hostname,
+		Strict:        opts.Strict,
+		DryRun:        opts.DryRun,
+		Status:        ReportPlanned,
+		Changes:       []ReportChange{},
+	}
+	if !state.Diff.HasChanges(opts.Strict) {
+		report.Status = TransactionUnchanged
+	}
+
+	for _, row := range diffRows(state.Diff, opts.Strict) {
+		sources := state.Diff.Desired[row.Package].Sources
+		if sources == nil {
+			sources = []PackageSource{}
+		}
+
+		report.Changes = append(report.Changes, ReportChange{
+			Action:  row.Action,
+			Package: row.Package,
+			Reason:  row.Reason,
+			Sources: sources,
+			Host:    state.Hostname,
+			Status:  StatusPlanned,
+		})
+	}
+
+	return report
+}
+
+// settle replaces the planned changes with what applying them did
+func (r *SyncReport) settle(result *ApplyResult, applyErr error) {
+	r.Status = transactionStatus(result, applyErr)
+	if applyErr != nil {
+		msg := applyErr.Error()
+		r.Error = &msg
+	}
+
+	planned := make(map[string]ReportChange, len(r.Changes))
+	for _, change := range r.Changes {
+		planned[string(change.Action)+" "+change.Package] = change
+	}
+
+	changes := make([]ReportChange, 0, len(result.Changes))
+	for _, change := range result.Changes {
+		c, ok := planned[string(change.Action)+" "+change.Package]
+		if !ok {
+			// Changes decided while applying, like removing demoted orphans
+			c = ReportChange{
+				Action:  change.Action,
+				Package: change.Package,
+				Reason:  "Orphaned after being demoted (strict mode)",
+				Sources: []PackageSource{},
+				Host:    r.Host,
+			}
+		}
+		c.Status = change.Status
+		c.Version = change.Version
+		changes = append(changes, c)
+	}
+	r.Changes = changes
+}
+
+// writeReport prints a report in a structured format
+func writeReport(w io.Writer, format OutputFormat, report any) error {
+	switch format {
+	case OutputYAML:
+		enc := yaml.NewEncoder(w)
+		enc.SetIndent(2)
+		if err := enc.Encode(report); err != nil {
+			return fmt.Errorf("failed to encode report: %w", err)
+		}
+		return enc.Close()
+	default:
+		data, err := json.MarshalIndent(report, "", "  ")
+		if err != nil {
+			return fmt.Errorf("failed to encode report: %w", err)
+		}
+		_, err = w.Write(append(data, '\n'))
+		return err
+	}
+}
+
+// reserveStdout keeps stdout for a structured report: until restore is
+// called, prompts, messages and pacman's own output go to stderr
+func reserveStdout(format OutputFormat) (stdout *os.File, restore func()) {
+	stdout = os.Stdout
+	if !format.Structured() {
+		return stdout, func() {}
+	}
+
+	os.Stdout = os.Stderr
+	return stdout, func() { os.Stdout = stdout }
+}
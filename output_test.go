@@ -0,0 +1,139 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// decodeReport writes the report as JSON and decodes it back generically, to
+// check the shape other tools see
+func decodeReport(t *testing.T, report SyncReport) map[string]any {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := writeReport(&buf, OutputJSON, report); err != nil {
+		t.Fatal(err)
+	}
+	var decoded map[string]any
+	if err := json.Unmarshal(buf.Bytes(), &decoded); err != nil {
+		t.Fatal(err)
+	}
+	return decoded
+}
+
+func reportKeys(m map[string]any) []string {
+	var keys []string
+	for key := range m {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+	return keys
+}
+
+func testReportState() *SyncState {
+	return &SyncState{
+		Hostname: "laptop",
+		Diff: PackageDiff{
+			ToAdd:             []string{"neovim"},
+			ToRemoveFromDitto: []string{"vim"},
+			Desired: map[string]DesiredPackage{
+				"neovim": {Name: "neovim", Sources: []PackageSource{{File: "base.pkgs", Line: 3}}},
+			},
+		},
+	}
+}
+
+func TestSyncReportJSON(t *testing.T) {
+	report := decodeReport(t, newSyncReport(testReportState(), SyncOptions{DryRun: true}))
+
+	if got, want := reportKeys(report), []string{"changes", "dry_run", "error", "format_version", "host", "status", "strict"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("report keys = %v, want %v", got, want)
+	}
+	want := map[string]any{
+		"format_version": float64(reportFormatVersion),
+		"host":           "laptop",
+		"strict":         false,
+		"dry_run":        true,
+		"status":         ReportPlanned,
+		"error":          nil,
+	}
+	for key, value := range want {
+		if report[key] != value {
+			t.Errorf("%s = %v, want %v", key, report[key], value)
+		}
+	}
+
+	changes := report["changes"].([]any)
+	if len(changes) != 2 {
+		t.Fatalf("changes = %v, want the install and the removal", changes)
+	}
+	install := changes[0].(map[string]any)
+	if got, want := reportKeys(install), []string{"action", "host", "package", "reason", "sources", "status"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("change keys = %v, want %v", got, want)
+	}
+	if install["action"] != "install" || install["package"] != "neovim" || install["status"] != "planned" || install["host"] != "laptop" {
+		t.Errorf("changes[0] = %v, want the planned install of neovim", install)
+	}
+	if got, want := install["sources"], []any{map[string]any{"file": "base.pkgs", "line": float64(3)}}; !reflect.DeepEqual(got, want) {
+		t.Errorf("sources = %v, want %v", got, want)
+	}
+	// Packages that are not desired anymore have no sources, but an empty list
+	if got := changes[1].(map[string]any)["sources"]; !reflect.DeepEqual(got, []any{}) {
+		t.Errorf("sources of the removal = %v, want []", got)
+	}
+}
+
+func TestSyncReportWithoutChanges(t *testing.T) {
+	report := decodeReport(t, newSyncReport(&SyncState{Hostname: "laptop"}, SyncOptions{}))
+	if report["status"] != TransactionUnchanged || !reflect.DeepEqual(report["changes"], []any{}) {
+		t.Errorf("report = %v, want an unchanged status and no changes", report)
+	}
+}
+
+func TestSyncReportSettle(t *testing.T) {
+	report := newSyncReport(testReportState(), SyncOptions{Strict: true})
+	result := &ApplyResult{Changes: []Change{
+		{Action: ActionInstall, Package: "neovim", Status: StatusSucceeded, Version: "0.10.0-1"},
+		{Action: ActionRemoveUnmanaged, Package: "vim", Status: StatusFailed},
+		{Action: ActionRemove, Package: "lua", Status: StatusSkipped},
+	}}
+	report.settle(result, errors.New("pacman failed"))
+
+	decoded := decodeReport(t, report)
+	if decoded["status"] != TransactionFailed || decoded["error"] != "pacman failed" {
+		t.Errorf("status = %v, error = %v, want the failure", decoded["status"], decoded["error"])
+	}
+
+	changes := decoded["changes"].([]any)
+	if len(changes) != 3 {
+		t.Fatalf("changes = %v, want every applied change", changes)
+	}
+	install := changes[0].(map[string]any)
+	if install["status"] != "succeeded" || install["version"] != "0.10.0-1" {
+		t.Errorf("changes[0] = %v, want the installed version", install)
+	}
+	if _, ok := changes[1].(map[string]any)["version"]; ok {
+		t.Errorf("changes[1] = %v, want no version when unknown", changes[1])
+	}
+	// Orphans removed while applying were not planned
+	orphan := changes[2].(map[string]any)
+	if orphan["package"] != "lua" || orphan["status"] != "skipped" || !strings.Contains(orphan["reason"].(string), "Orphaned") {
+		t.Errorf("changes[2] = %v, want the orphan removal", orphan)
+	}
+}
+
+func TestWriteReportYAML(t *testing.T) {
+	var buf bytes.Buffer
+	if err := writeReport(&buf, OutputYAML, newSyncReport(&SyncState{Hostname: "laptop"}, SyncOptions{})); err != nil {
+		t.Fatal(err)
+	}
+	for _, line := range []string{"format_version: 1", "host: laptop", "status: unchanged", "error: null", "changes: []"} {
+		if !strings.Contains(buf.String(), line+"\n") {
+			t.Errorf("YAML report has no %q line:\n%s", line, buf.String())
+		}
+	}
+}
@@ -1,11 +1,15 @@
 package main
 
 import (
-	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
 	"io/fs"
 	"log"
 	"os"
 	"path/filepath"
+	"slices"
 	"strings"
 )
 
@@ -14,11 +18,90 @@ type PackageDef struct {
 }
 
 type Definition struct {
-	Packages []string
+	// File is the definition path relative to the packages directory
+	File string
+	// Description is the comment block at the top of the file
+	Description string
+	Packages    []PackageEntry
+	Groups      []GroupEntry
+	// Excludes are the packages removed from the host's set with "!pkg"
+	Excludes []PackageEntry
 	Host     *string
+	// Role is set for definitions under roles/, applying to every host of the role
+	Role *string
+	// Profile is set for definitions under profiles/, applying only where the profile is enabled
+	Profile *string
 }
 
-const FILE_EXTENSION = ".pkgs"
+// PackageEntry is a package declared on a given line of a definition file
+type PackageEntry struct {
+	Name string
+	Line int
+	// Comment is the inline comment of the line, without "#"
+	Comment string
+	// When are the conditions on the facts of the machine the entry applies under
+	When Conditions
+}
+
+// PackageSource is where a package is declared: a definition file and a line in it
+type PackageSource struct {
+	File    string `json:"file" yaml:"file"`
+	Line    int    `json:"line" yaml:"line"`
+	Comment string `json:"comment,omitempty" yaml:"comment,omitempty"`
+	// Description is the description of the whole file
+	Description string `json:"description,omitempty" yaml:"description,omitempty"`
+	// Role is set when the file belongs to a role
+	Role string `json:"role,omitempty" yaml:"role,omitempty"`
+	// Profile is set when the file belongs to a profile
+	Profile string `json:"profile,omitempty" yaml:"profile,omitempty"`
+	// When are the conditions of the [if] blocks enclosing the entry, set
+	// only when they could not be evaluated because the host's facts are unknown
+	When string `json:"when,omitempty" yaml:"when,omitempty"`
+}
+
+// Conditional reports whether the entry only applies if unevaluated conditions hold
+func (s PackageSource) Conditional() bool {
+	return s.When != ""
+}
+
+func (s PackageSource) String() string {
+	return fmt.Sprintf("%s:%d", s.File, s.Line)
+}
+
+// Annotation is what the definitions say about the entry: its inline
+// comment, or else the description of its file
+func (s PackageSource) Annotation() string {
+	if s.Comment != "" {
+		return s.Comment
+	}
+	return s.Description
+}
+
+// GroupEntry is a package group declared with "@group", minus any "!pkg" exclusions
+type GroupEntry struct {
+	Name    string
+	Exclude []string
+	Line    int
+	// Comment is the inline comment of the line, without "#"
+	Comment string
+	// When are the conditions on the facts of the machine the entry applies under
+	When Conditions
+}
+
+const (
+	FILE_EXTENSION = ".pkgs"
+	GROUP_PREFIX   = "@"
+	EXCLUDE_PREFIX = "!"
+)
+
+// Role definitions rank above global ones of any depth, and host-specific ones
+// above both: regexes, then globs, then exact host names. Profiles, enabled on
+// purpose, rank above everything.
+const (
+	rolePrecedence    = 1000
+	hostPrecedence    = 2000
+	profilePrecedence = 5000
+)
 
 func NewPackageDef() *PackageDef {
 	configPath, err := getConfigPath()
@@ -30,8 +113,11 @@ func NewPackageDef() *PackageDef {
 	return &PackageDef{path: packagesPath}
 }
 
+// LoadAllDefinitions parses every definition file. Invalid files are reported
+// together in the returned error, the valid ones are still returned.
 func (pd *PackageDef) LoadAllDefinitions() ([]Definition, error) {
 	var defs []Definition
+	var errs []error
 
 	err := filepath.WalkDir(pd.path, func(path string, d fs.DirEntry, err error) error {
 		if err != nil {
@@ -44,89 +130,335 @@ func (pd *PackageDef) LoadAllDefinitions() ([]Definition, error) {
 		if d.Type().IsRegular() && strings.HasSuffix(path, FILE_EXTENSION) {
 			def, err := pd.parseDefFile(path)
 			if err != nil {
-				return err
+				errs = append(errs, err)
+				return nil
+			}
+			if def.IsEmpty() {
+				log.Printf("warning: no packages defined in %s", def.File)
 			}
 			defs = append(defs, def)
 		}
 		return nil
 	})
+	if err != nil {
+		return defs, err
+	}
 
-	return defs, err
+	return defs, errors.Join(errs...)
 }
 
-func (pd *PackageDef) parseDefFile(file string) (Definition, error) {
-	pkgs, err := readPackagesFromFile(file)
+// Hash fingerprints every definition and roles file with its path, to detect changes
+func (pd *PackageDef) Hash() (string, error) {
+	h := sha256.New()
+
+	err := filepath.WalkDir(pd.path, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+
+		if d.Type().IsRegular() && (strings.HasSuffix(path, FILE_EXTENSION) || strings.HasSuffix(path, ROLES_EXTENSION)) {
+			data, err := os.ReadFile(path)
+			if err != nil {
+				return err
+			}
+			relPath, err := filepath.Rel(pd.path, path)
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(h, "%s\x00%d\x00", relPath, len(data))
+			h.Write(data)
+		}
+		return nil
+	})
+
+	return "sha256:" + hex.EncodeToString(h.Sum(nil)), err
+}
+
+// Files returns every definition file, relative to the packages directory
+func (pd *PackageDef) Files() ([]string, error) {
+	var files []string
+
+	err := filepath.WalkDir(pd.path, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+
+		if d.Type().IsRegular() && strings.HasSuffix(path, FILE_EXTENSION) {
+			relPath, err := filepath.Rel(pd.path, path)
+			if err != nil {
+				return err
+			}
+			files = append(files, relPath)
+		}
+		return nil
+	})
+
+	return files, err
+}
+
+// Rel turns a path to a definition file into a path relative to the packages directory
+func (pd *PackageDef) Rel(path string) (string, error) {
+	abs, err := filepath.Abs(path)
 	if err != nil {
-		return Definition{}, err
+		return "", err
 	}
+	rel, err := filepath.Rel(pd.path, abs)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(os.PathSeparator)) {
+		return "", fmt.Errorf("%s is not in the packages directory %s", path, pd.path)
+	}
+	return rel, nil
+}
 
-	host, err := inferHost(pd.path, file)
+// AppendPackage adds a package at the end of a definition file, given
+// relative to the packages directory
+func (pd *PackageDef) AppendPackage(file, name string) error {
+	df, err := pd.Open(file)
 	if err != nil {
-		return Definition{}, err
+		return err
 	}
-
-	return Definition{
-		Packages: pkgs,
-		Host:     host,
-	}, nil
+	df.Append(name)
+	return pd.Save(file, df)
 }
 
-func readPackagesFromFile(file string) ([]string, error) {
-	f, err := os.Open(file)
+// Open parses a definition file, given relative to the packages directory
+func (pd *PackageDef) Open(file string) (*DefFile, error) {
+	data, err := os.ReadFile(filepath.Join(pd.path, file))
 	if err != nil {
 		return nil, err
 	}
-	defer f.Close()
+	return parseDefContent(file, data)
+}
+
+// Save writes a definition file opened with Open, or a new one
+func (pd *PackageDef) Save(file string, df *DefFile) error {
+	return pd.WriteFile(file, df.Bytes())
+}
+
+// Exists reports whether a definition file, given relative to the packages directory, exists
+func (pd *PackageDef) Exists(file string) bool {
+	_, err := os.Stat(filepath.Join(pd.path, file))
+	return err == nil
+}
+
+// WriteFile writes a definition file, given relative to the packages directory,
+// creating its parent directories
+func (pd *PackageDef) WriteFile(file string, data []byte) error {
+	path := filepath.Join(pd.path, file)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0644)
+}
+
+// ScopeOf returns the scope of a definition file given relative to the packages directory
+func (pd *PackageDef) ScopeOf(file string) (string, error) {
+	path := filepath.Join(pd.path, file)
+	host, err := inferScopeName(pd.path, path, "hosts")
+	if err != nil {
+		return globalScope, err
+	}
+	role, err := inferScopeName(pd.path, path, "roles")
+	if err != nil {
+		return globalScope, err
+	}
+	profile, err := inferScopeName(pd.path, path, "profiles")
+	if err != nil {
+		return globalScope, err
+	}
+	return Definition{Host: host, Role: role, Profile: profile}.Scope(), nil
+}
+
+// AppliesTo reports whether the definition is global, scoped to the machine's
+// host, to one of its roles or to one of its enabled profiles
+func (def Definition) AppliesTo(machine Machine) bool {
+	return machine.Covers(def.Scope())
+}
+
+// ManagedScope returns the scope the packages of the definition are recorded
+// under in the database: role, profile and host pattern definitions are managed
+// for the host itself, so that they become removable once they stop applying
+func (def Definition) ManagedScope(hostname string) string {
+	if def.Role != nil || def.Profile != nil || (def.Host != nil && isHostPattern(*def.Host)) {
+		return hostname
+	}
+	return def.Scope()
+}
 
-	var pkgs []string
-	scanner := bufio.NewScanner(f)
+// Source returns where an entry of the definition is declared
+func (def Definition) Source(line int, comment string) PackageSource {
+	source := PackageSource{File: def.File, Line: line, Comment: comment, Description: def.Description}
+	if def.Role != nil {
+		source.Role = *def.Role
+	}
+	if def.Profile != nil {
+		source.Profile = *def.Profile
+	}
+	return source
+}
 
-	for scanner.Scan() {
-		line := parseLine(scanner.Text())
-		if line != "" {
-			pkgs = append(pkgs, line)
+// Precedence decides between a "!pkg" line and a declaration of the same
+// package: profile files override host-specific files, which override role
+// files, which override global ones, then deeper paths override shallower
+// ones. The highest wins, the exclusion on a tie.
+func (def Definition) Precedence() int {
+	precedence := strings.Count(def.File, string(os.PathSeparator))
+	switch {
+	case def.Profile != nil:
+		precedence += profilePrecedence
+	case def.Host != nil:
+		precedence += hostPrecedence + rolePrecedence*int(hostMatchOf(*def.Host))
+	case def.Role != nil:
+		precedence += rolePrecedence
+	}
+	return precedence
+}
+
+// Scope returns the host the definition is scoped to, its role prefixed with
+// rolePrefix, its profile prefixed with profilePrefix, or globalScope
+func (def Definition) Scope() string {
+	switch {
+	case def.Host != nil:
+		return *def.Host
+	case def.Role != nil:
+		return roleScope(*def.Role)
+	case def.Profile != nil:
+		return profileScope(*def.Profile)
+	default:
+		return globalScope
+	}
+}
+
+// parseDefFile parses a definition file. When only some of its lines are
+// invalid, the definition of the valid ones is returned along with the error.
+func (pd *PackageDef) parseDefFile(file string) (Definition, error) {
+	relPath, err := filepath.Rel(pd.path, file)
+	if err != nil {
+		return Definition{}, err
+	}
+
+	host, err := inferScopeName(pd.path, file, "hosts")
+	if err != nil {
+		return Definition{}, err
+	}
+	if host != nil {
+		if err := validateHostEntry(*host); err != nil {
+			return Definition{}, fmt.Errorf("%s: %w", relPath, err)
 		}
 	}
 
-	if err := scanner.Err(); err != nil {
-		return nil, err
+	role, err := inferScopeName(pd.path, file, "roles")
+	if err != nil {
+		return Definition{}, err
 	}
 
-	if len(pkgs) == 0 {
-		log.Printf("warning: no packages defined in %s", file)
+	profile, err := inferScopeName(pd.path, file, "profiles")
+	if err != nil {
+		return Definition{}, err
+	}
+
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return Definition{}, err
 	}
 
-	return pkgs, nil
+	df, err := parseDefContent(relPath, data)
+	return Definition{
+		File:        relPath,
+		Description: df.Description(),
+		Packages:    df.Packages(),
+		Groups:      df.Groups(),
+		Excludes:    df.Excludes(),
+		Host:        host,
+		Role:        role,
+		Profile:     profile,
+	}, err
 }
 
-// parseLine trims whitespace and removes comments from a single line.
-func parseLine(line string) string {
-	line = strings.TrimSpace(line)
-	if line == "" || strings.HasPrefix(line, "#") {
-		return ""
+// Conditional reports whether the definition has entries in [if] blocks
+func (def Definition) Conditional() bool {
+	for _, pkg := range slices.Concat(def.Packages, def.Excludes) {
+		if len(pkg.When) > 0 {
+			return true
+		}
 	}
-	if idx := strings.Index(line, "#"); idx != -1 {
+	return slices.ContainsFunc(def.Groups, func(group GroupEntry) bool { return len(group.When) > 0 })
+}
+
+// IsEmpty reports whether the definition declares neither packages, groups nor exclusions
+func (def Definition) IsEmpty() bool {
+	return len(def.Packages) == 0 && len(def.Groups) == 0 && len(def.Excludes) == 0
+}
+
+// parseLine trims whitespace from a single line and splits off its comment.
+// A "#" inside double quotes, as in the value of an [if] directive, is not a comment.
+func parseLine(line string) (text, comment string) {
+	line = strings.TrimSpace(line)
+	if idx := commentIndex(line); idx != -1 {
+		comment = strings.TrimSpace(line[idx+1:])
 		line = strings.TrimSpace(line[:idx])
 	}
-	return line
+	return line, comment
+}
+
+// commentIndex returns the index of the "#" starting the comment of a line, or -1
+func commentIndex(line string) int {
+	inQuotes := false
+	for i := 0; i < len(line); i++ {
+		switch {
+		case inQuotes && line[i] == '\\':
+			i++
+		case line[i] == '"':
+			inQuotes = !inQuotes
+		case line[i] == '#' && !inQuotes:
+			return i
+		}
+	}
+	return -1
+}
+
+// parseGroup parses a "@group !member..." line.
+func parseGroup(line string) (GroupEntry, error) {
+	fields := strings.Fields(line)
+	name := strings.TrimPrefix(fields[0], GROUP_PREFIX)
+	if name == "" {
+		return GroupEntry{}, fmt.Errorf("missing group name in %q", line)
+	}
+
+	group := GroupEntry{Name: name}
+	for _, field := range fields[1:] {
+		member, ok := strings.CutPrefix(field, EXCLUDE_PREFIX)
+		if !ok || member == "" {
+			return GroupEntry{}, fmt.Errorf("invalid group exclusion %q in %q", field, line)
+		}
+		group.Exclude = append(group.Exclude, member)
+	}
+
+	return group, nil
 }
 
-// inferHost extracts the host name based on the file's relative path.
-func inferHost(basePath, file string) (*string, error) {
+// inferScopeName extracts the host, role or profile name from the file's
+// relative path, for files under dir ("hosts", "roles" or "profiles").
+func inferScopeName(basePath, file, dir string) (*string, error) {
 	relPath, err := filepath.Rel(basePath, file)
 	if err != nil {
 		return nil, err
 	}
 
 	parts := strings.Split(relPath, string(os.PathSeparator))
-	if len(parts) >= 2 && parts[0] == "hosts" {
-		var hostVal string
+	if len(parts) >= 2 && parts[0] == dir {
+		var name string
 		if len(parts) == 2 {
-			hostVal = strings.TrimSuffix(parts[1], FILE_EXTENSION)
+			name = strings.TrimSuffix(parts[1], FILE_EXTENSION)
 		} else {
-			hostVal = parts[1]
+			name = parts[1]
 		}
-		return &hostVal, nil
+		return &name, nil
 	}
 
 	return nil, nil
@@ -4,11 +4,16 @@ import (
 	"fmt"
 	"os"
 	"os/exec"
+	"path/filepath"
 	"strings"
+	"time"
 )
 
 // Pacman (or AUR helper) wrapper
 type Pacman struct {
+	localDB            *LocalDB
+	syncDB             *SyncDB
+	cacheDir           string
 	binary             string
 	isAurHelper        bool
 	noConfirm          bool
@@ -24,6 +29,9 @@ func NewPacman(cfg *Config) *Pacman {
 	}
 
 	return &Pacman{
+		localDB:            NewLocalDB(cfg.DBPath),
+		syncDB:             NewSyncDB(cfg.DBPath),
+		cacheDir:           cfg.CacheDir,
 		binary:             bin,
 		isAurHelper:        cfg.AurHelper != "",
 		noConfirm:          cfg.NoConfirm,
@@ -42,30 +50,102 @@ func (p *Pacman) exec(args []string) *exec.Cmd {
 	return exec.Command("sudo", baseArgs...)
 }
 
-// ListInstalled returns all installed package names
-func (p *Pacman) ListInstalled() ([]string, error) {
-	cmd := exec.Command(p.binary, "-Q")
-	out, err := cmd.Output()
+// InstallReason tells whether a package was installed explicitly or as a dependency
+type InstallReason int
+
+const (
+	ReasonExplicit InstallReason = iota
+	ReasonDependency
+)
+
+// InstalledPackage is a package currently present on the system
+type InstalledPackage struct {
+	Name        string
+	Version     string
+	Description string
+	Reason      InstallReason
+	InstallDate time.Time
+	Size        int64
+	Groups      []string
+	Provides    []string
+	Replaces    []string
+	Depends     []string
+	OptDepends  []string
+	RequiredBy  []string
+	OptionalFor []string
+}
+
+// ListInstalled returns all installed packages, read from the local pacman database
+func (p *Pacman) ListInstalled() ([]InstalledPackage, error) {
+	pkgs, err := p.localDB.Packages()
 	if err != nil {
 		return nil, fmt.Errorf("failed to list installed packages: %w", err)
 	}
+	return pkgs, nil
+}
 
-	lines := strings.Split(string(out), "\n")
-	pkgs := make([]string, 0, len(lines))
+// ListOrphans returns packages installed as dependencies that nothing requires anymore
+func (p *Pacman) ListOrphans() ([]string, error) {
+	pkgs, err := p.localDB.Packages()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list orphan packages: %w", err)
+	}
 
-	for _, line := range lines {
-		line = strings.TrimSpace(line)
-		if line == "" {
-			continue
+	var orphans []string
+	for _, pkg := range pkgs {
+		if pkg.Reason == ReasonDependency && len(pkg.RequiredBy) == 0 && len(pkg.OptionalFor) == 0 {
+			orphans = append(orphans, pkg.Name)
 		}
-		// pacman -Q output: "pkgname version"
-		parts := strings.SplitN(line, " ", 2)
-		pkgs = append(pkgs, parts[0])
 	}
+	return orphans, nil
+}
 
+// ListAvailable returns the packages offered by the configured repositories
+func (p *Pacman) ListAvailable() ([]SyncPackage, error) {
+	pkgs, err := p.syncDB.Packages()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list available packages: %w", err)
+	}
 	return pkgs, nil
 }
 
+// SkippedRepos returns the repositories ListAvailable could not read
+func (p *Pacman) SkippedRepos() []string {
+	return p.syncDB.Skipped()
+}
+
+// GroupMembers returns the packages of a group, looked up in the sync databases
+// first and in the local database when the group is not available from any repo
+func (p *Pacman) GroupMembers(group string) ([]string, error) {
+	members, err := p.syncDB.GroupMembers(group)
+	if err == nil && len(members) > 0 {
+		return members, nil
+	}
+
+	members, err = p.localDB.GroupMembers(group)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list members of group %s: %w", group, err)
+	}
+	if len(members) == 0 {
+		return nil, fmt.Errorf("unknown package group %q", group)
+	}
+
+	return members, nil
+}
+
+// CachedPackage returns the path of a package archive in the pacman cache
+// for an exact version, or "" when it is not cached
+func (p *Pacman) CachedPackage(name, version string) string {
+	matches, _ := filepath.Glob(filepath.Join(p.cacheDir, fmt.Sprintf("%s-%s-*.pkg.tar*", name, version)))
+	for _, match := range matches {
+		// Skip detached signatures
+		if !strings.HasSuffix(match, ".sig") {
+			return match
+		}
+	}
+	return ""
+}
+
 // Install packages with optional extra args
 func (p *Pacman) Install(pkgs []string, extraArgs ...string) error {
 	args := []string{"-S"}
@@ -90,6 +170,29 @@ func (p *Pacman) Install(pkgs []string, extraArgs ...string) error {
 	return nil
 }
 
+// InstallFiles installs package archives (e.g. from the package cache) with pacman -U
+func (p *Pacman) InstallFiles(paths []string, extraArgs ...string) error {
+	args := []string{"-U"}
+	args = append(args, extraArgs...)
+
+	if p.noConfirm {
+		args = append(args, "--noconfirm")
+	}
+
+	args = append(args, paths...)
+
+	cmd := p.exec(args)
+	cmd.Stdout = os.Stdout
+	cmd.Stdin = os.Stdin
+	cmd.Stderr = os.Stderr
+
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("failed to install package files: %w", err)
+	}
+
+	return nil
+}
+
 // Remove packages with optional extra args
 func (p *Pacman) Remove(pkgs []string, extraArgs ...string) error {
 	args := []string{"-R"}
@@ -108,3 +211,27 @@ func (p *Pacman) Remove(pkgs []string, extraArgs ...string) error {
 
 	return nil
 }
+
+// MarkExplicit changes the install reason of packages to explicitly installed
+func (p *Pacman) MarkExplicit(pkgs []string) error {
+	return p.setReason("--asexplicit", pkgs)
+}
+
+// MarkAsDeps changes the install reason of packages to installed as a dependency
+func (p *Pacman) MarkAsDeps(pkgs []string) error {
+	return p.setReason("--asdeps", pkgs)
+}
+
+func (p *Pacman) setReason(flag string, pkgs []string) error {
+	args := append([]string{"-D", flag}, pkgs...)
+
+	cmd := p.exec(args)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("failed to mark packages %s: %w", flag, err)
+	}
+
+	return nil
+}
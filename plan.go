@@ -0,0 +1,265 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"os"
+	"slices"
+	"strings"
+	"time"
+)
+
+// planFormatVersion is bumped whenever the plan file layout changes incompatibly
+const planFormatVersion = 1
+
+// Plan is a sync computed by "ditto plan" and executed as-is by "ditto apply".
+// Its JSON form is meant to be read by other tools as well.
+type Plan struct {
+	FormatVersion   int           `json:"format_version"`
+	CreatedAt       time.Time     `json:"created_at"`
+	Host            string        `json:"host"`
+	Strict          bool          `json:"strict"`
+	InstallArgs     []string      `json:"install_args"`
+	RemoveArgs      []string      `json:"remove_args"`
+	DefinitionsHash string        `json:"definitions_hash"`
+	InstalledHash   string        `json:"installed_hash"`
+	Diff            PlanDiff      `json:"diff"`
+	Changes         []PlanChange  `json:"changes"`
+	Desired         []PlanPackage `json:"desired"`
+}
+
+// PlanDiff is the serialized PackageDiff
+type PlanDiff struct {
+	Install         []string `json:"install"`
+	MarkExplicit    []string `json:"mark_explicit"`
+	Demote          []string `json:"demote"`
+	RemoveUnmanaged []string `json:"remove_unmanaged"`
+}
+
+// PlanChange is a row of the changes table
+type PlanChange struct {
+	Action  ChangeAction `json:"action"`
+	Package string       `json:"package"`
+	Reason  string       `json:"reason"`
+}
+
+// PlanPackage is a desired package, recorded as managed once the plan is applied
+type PlanPackage struct {
+	Name   string   `json:"name"`
+	Scopes []string `json:"scopes"`
+}
+
+// PlanSync computes a sync and writes it to a plan file ("-" for stdout)
+func PlanSync(opts SyncOptions, output string, appCtx *AppContext) error {
+	ctx := context.Background()
+
+	state, err := prepareSync(ctx, opts, appCtx)
+	if err != nil {
+		return err
+	}
+
+	definitionsHash, err := hashDefinitions(state.Hostname, appCtx)
+	if err != nil {
+		return fmt.Errorf("failed to hash definitions: %w", err)
+	}
+
+	plan := newPlan(state, opts, definitionsHash)
+
+	if output == "" {
+		printPackageChanges(appCtx, state.Diff, opts.Strict)
+		return nil
+	}
+
+	data, err := json.MarshalIndent(plan, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode plan: %w", err)
+	}
+	data = append(data, '\n')
+
+	if output == "-" {
+		_, err = os.Stdout.Write(data)
+		return err
+	}
+
+	printPackageChanges(appCtx, state.Diff, opts.Strict)
+	if err := os.WriteFile(output, data, 0644); err != nil {
+		return fmt.Errorf("failed to write plan: %w", err)
+	}
+	fmt.Printf("Plan saved to %s, run 'ditto apply %s' to execute it.\n", output, output)
+	return nil
+}
+
+// ApplyPlan executes a plan file, refusing to run when the definitions or the
+// installed packages changed since the plan was made. Only the confirmation
+// settings and the host of opts are used, everything else comes from the plan.
+func ApplyPlan(file string, opts SyncOptions, appCtx *AppContext) error {
+	ctx := context.Background()
+	started := time.Now()
+
+	plan, err := readPlan(file)
+	if err != nil {
+		return err
+	}
+
+	hostname, err := currentHostname(opts.Host)
+	if err != nil {
+		return err
+	}
+	if plan.Host != hostname {
+		return fmt.Errorf("plan was made for host %s, not %s", plan.Host, hostname)
+	}
+
+	definitionsHash, err := hashDefinitions(hostname, appCtx)
+	if err != nil {
+		return fmt.Errorf("failed to hash definitions: %w", err)
+	}
+	if definitionsHash != plan.DefinitionsHash {
+		return fmt.Errorf("definitions changed since the plan was made, run 'ditto plan' again")
+	}
+
+	installed, err := appCtx.Pacman.ListInstalled()
+	if err != nil {
+		return fmt.Errorf("failed to list installed packages: %w", err)
+	}
+	if hashInstalled(installed) != plan.InstalledHash {
+		return fmt.Errorf("installed packages changed since the plan was made, run 'ditto plan' again")
+	}
+
+	opts = SyncOptions{
+		Strict:      plan.Strict,
+		InstallArgs: plan.InstallArgs,
+		RemoveArgs:  plan.RemoveArgs,
+		FromPlan:    true,
+		Yes:         opts.Yes,
+		ConfirmEach: opts.ConfirmEach,
+	}
+
+	rows := make([]ChangeRow, len(plan.Changes))
+	for i, change := range plan.Changes {
+		rows[i] = ChangeRow{change.Action, change.Package, change.Reason}
+	}
+	if len(rows) > 0 {
+		printChangeRows(appCtx, rows)
+	}
+
+	_, err = executeSync(ctx, appCtx, plan.syncState(installed), opts, started)
+	return err
+}
+
+func newPlan(state *SyncState, opts SyncOptions, definitionsHash string) Plan {
+	plan := Plan{
+		FormatVersion:   planFormatVersion,
+		CreatedAt:       time.Now().UTC(),
+		Host:            state.Hostname,
+		Strict:          opts.Strict,
+		InstallArgs:     nonNil(opts.InstallArgs),
+		RemoveArgs:      nonNil(opts.RemoveArgs),
+		DefinitionsHash: definitionsHash,
+		InstalledHash:   hashInstalled(state.Installed),
+		Diff: PlanDiff{
+			Install:         nonNil(state.Diff.ToAdd),
+			RemoveUnmanaged: nonNil(state.Diff.ToRemoveFromDitto),
+			MarkExplicit:    []string{},
+			Demote:          []string{},
+		},
+		Changes: []PlanChange{},
+		Desired: make([]PlanPackage, len(state.Desired)),
+	}
+
+	// Strict-only changes are left out of non-strict plans, like sync does
+	if opts.Strict {
+		plan.Diff.MarkExplicit = nonNil(state.Diff.ToMarkExplicit)
+		plan.Diff.Demote = nonNil(state.Diff.ToRemove)
+	}
+
+	for _, row := range diffRows(state.Diff, opts.Strict) {
+		plan.Changes = append(plan.Changes, PlanChange{row.Action, row.Package, row.Reason})
+	}
+
+	for i, pkg := range state.Desired {
+		plan.Desired[i] = PlanPackage{Name: pkg.Name, Scopes: pkg.Scopes}
+	}
+
+	return plan
+}
+
+// syncState rebuilds the state a sync needs to execute the plan
+func (plan Plan) syncState(installed []InstalledPackage) *SyncState {
+	desired := make([]DesiredPackage, len(plan.Desired))
+	for i, pkg := range plan.Desired {
+		desired[i] = DesiredPackage{Name: pkg.Name, Scopes: pkg.Scopes}
+	}
+
+	return &SyncState{
+		Hostname:  plan.Host,
+		Installed: installed,
+		Desired:   desired,
+		Diff: PackageDiff{
+			ToAdd:             plan.Diff.Install,
+			ToRemove:          plan.Diff.Demote,
+			ToRemoveFromDitto: plan.Diff.RemoveUnmanaged,
+			ToMarkExplicit:    plan.Diff.MarkExplicit,
+		},
+	}
+}
+
+func readPlan(file string) (Plan, error) {
+	var plan Plan
+
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return plan, fmt.Errorf("failed to read plan: %w", err)
+	}
+	if err := json.Unmarshal(data, &plan); err != nil {
+		return plan, fmt.Errorf("failed to parse plan %s: %w", file, err)
+	}
+	if plan.FormatVersion != planFormatVersion {
+		return plan, fmt.Errorf("unsupported plan format version %d", plan.FormatVersion)
+	}
+
+	return plan, nil
+}
+
+// hashDefinitions fingerprints what the desired packages of the host depend on
+// besides the installed ones: the definition and roles files, the roles of the
+// config and the profiles enabled for the host
+func hashDefinitions(hostname string, appCtx *AppContext) (string, error) {
+	filesHash, err := appCtx.PackageDef.Hash()
+	if err != nil {
+		return "", err
+	}
+
+	h := sha256.New()
+	fmt.Fprintf(h, "%s\n", filesHash)
+	for _, host := range slices.Sorted(maps.Keys(appCtx.Config.Roles)) {
+		fmt.Fprintf(h, "%s\x00%s\n", host, strings.Join(appCtx.Config.Roles[host], "\x00"))
+	}
+
+	// Profiles given with --profile for the plan only are part of its changes already
+	profiles, err := enabledProfiles(hostname, nil, appCtx)
+	if err != nil {
+		return "", err
+	}
+	fmt.Fprintf(h, "profiles\x00%s\n", strings.Join(profiles, "\x00"))
+	return "sha256:" + hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// hashInstalled fingerprints the installed packages with their version and install reason
+func hashInstalled(pkgs []InstalledPackage) string {
+	h := sha256.New()
+	for _, pkg := range pkgs {
+		fmt.Fprintf(h, "%s\x00%s\x00%d\n", pkg.Name, pkg.Version, pkg.Reason)
+	}
+	return "sha256:" + hex.EncodeToString(h.Sum(nil))
+}
+
+func nonNil(values []string) []string {
+	if values == nil {
+		return []string{}
+	}
+	return values
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// testPlan returns a plan without changes for test-host, made against the
+// definitions of appCtx and the local database fixture
+func testPlan(t *testing.T, appCtx *AppContext) Plan {
+	t.Helper()
+
+	definitionsHash, err := hashDefinitions("test-host", appCtx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	state := &SyncState{
+		Hostname:  "test-host",
+		Installed: fixtureInstalled(t),
+		Desired:   []DesiredPackage{{Name: "zsh", Scopes: []string{"test-host"}}},
+	}
+	return newPlan(state, SyncOptions{}, definitionsHash)
+}
+
+func writePlan(t *testing.T, plan Plan) string {
+	t.Helper()
+	data, err := json.Marshal(plan)
+	if err != nil {
+		t.Fatal(err)
+	}
+	file := filepath.Join(t.TempDir(), "plan.json")
+	if err := os.WriteFile(file, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return file
+}
+
+func TestApplyPlanDrift(t *testing.T) {
+	tests := []struct {
+		name    string
+		host    string
+		change  func(t *testing.T, plan *Plan, appCtx *AppContext)
+		wantErr string
+	}{
+		{
+			name:    "another host",
+			host:    "tower",
+			wantErr: "plan was made for host test-host, not tower",
+		},
+		{
+			name: "definitions changed",
+			change: func(t *testing.T, plan *Plan, appCtx *AppContext) {
+				if err := os.WriteFile(filepath.Join(appCtx.PackageDef.path, "base.pkgs"), []byte("git\n"), 0o644); err != nil {
+					t.Fatal(err)
+				}
+			},
+			wantErr: "definitions changed since the plan was made",
+		},
+		{
+			name: "roles changed",
+			change: func(t *testing.T, plan *Plan, appCtx *AppContext) {
+				appCtx.Config.Roles = map[string][]string{"test-host": {"servers"}}
+			},
+			wantErr: "definitions changed since the plan was made",
+		},
+		{
+			name: "installed packages changed",
+			change: func(t *testing.T, plan *Plan, appCtx *AppContext) {
+				plan.InstalledHash = hashInstalled(fixtureInstalled(t)[1:])
+			},
+			wantErr: "installed packages changed since the plan was made",
+		},
+		{
+			name: "unsupported format",
+			change: func(t *testing.T, plan *Plan, appCtx *AppContext) {
+				plan.FormatVersion = planFormatVersion + 1
+			},
+			wantErr: "unsupported plan format version",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			appCtx := newTestAppContext(t, "testdata/import")
+			plan := testPlan(t, appCtx)
+			if tt.change != nil {
+				tt.change(t, &plan, appCtx)
+			}
+			host := "test-host"
+			if tt.host != "" {
+				host = tt.host
+			}
+
+			err := ApplyPlan(writePlan(t, plan), SyncOptions{Host: host, Yes: true}, appCtx)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("ApplyPlan() = %v, want an error containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestApplyPlanWithoutDrift(t *testing.T) {
+	appCtx := newTestAppContext(t, "testdata/import")
+	file := writePlan(t, testPlan(t, appCtx))
+
+	if err := ApplyPlan(file, SyncOptions{Host: "test-host", Yes: true}, appCtx); err != nil {
+		t.Fatal(err)
+	}
+
+	// The desired packages of the plan are recorded as managed
+	pkgs, err := appCtx.QueryClient.GetPackagesByHost(context.Background(), "test-host")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pkgs) != 1 || pkgs[0].Name != "zsh" {
+		t.Errorf("managed packages = %+v, want zsh", pkgs)
+	}
+}
+
+func TestNewPlanLeavesStrictChangesOut(t *testing.T) {
+	state := &SyncState{
+		Hostname: "test-host",
+		Diff: PackageDiff{
+			ToAdd:          []string{"neovim"},
+			ToMarkExplicit: []string{"groff"},
+			ToRemove:       []string{"zsh"},
+		},
+	}
+
+	plan := newPlan(state, SyncOptions{}, "sha256:defs")
+	if !reflect.DeepEqual(plan.Diff, PlanDiff{Install: []string{"neovim"}, MarkExplicit: []string{}, Demote: []string{}, RemoveUnmanaged: []string{}}) {
+		t.Errorf("Diff = %+v, want the install only", plan.Diff)
+	}
+	for _, change := range plan.Changes {
+		if change.Package != "neovim" {
+			t.Errorf("Changes has %+v, want the install only", change)
+		}
+	}
+
+	strict := newPlan(state, SyncOptions{Strict: true}, "sha256:defs")
+	if got := strict.syncState(nil).Diff; !reflect.DeepEqual(got.ToMarkExplicit, []string{"groff"}) || !reflect.DeepEqual(got.ToRemove, []string{"zsh"}) {
+		t.Errorf("syncState().Diff = %+v, want the strict changes of the plan", got)
+	}
+}
@@ -0,0 +1,170 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/ony-boom/ditto/database"
+)
+
+// profilePrefix marks the scope of profile definitions, to tell them from host names
+const profilePrefix = "profile:"
+
+func profileScope(profile string) string {
+	return profilePrefix + profile
+}
+
+// Profiles returns the profiles defined under profiles/, as a directory or a .pkgs file
+func (pd *PackageDef) Profiles() ([]string, error) {
+	entries, err := os.ReadDir(filepath.Join(pd.path, "profiles"))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var profiles []string
+	for _, entry := range entries {
+		switch {
+		case entry.IsDir():
+			profiles = append(profiles, entry.Name())
+		case strings.HasSuffix(entry.Name(), FILE_EXTENSION):
+			profiles = append(profiles, strings.TrimSuffix(entry.Name(), FILE_EXTENSION))
+		}
+	}
+	slices.Sort(profiles)
+	return slices.Compact(profiles), nil
+}
+
+// enabledProfiles returns the profiles enabled for the host in the database
+// plus the given ones, which have to be defined
+func enabledProfiles(hostname string, extra []string, appCtx *AppContext) ([]string, error) {
+	profiles, err := appCtx.QueryClient.ListHostProfiles(context.Background(), hostname)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list the profiles of %s: %w", hostname, err)
+	}
+
+	if len(extra) > 0 {
+		if err := checkProfiles(extra, appCtx); err != nil {
+			return nil, err
+		}
+		profiles = append(profiles, extra...)
+	}
+	slices.Sort(profiles)
+	return slices.Compact(profiles), nil
+}
+
+// checkProfiles fails on the first profile that has no definitions
+func checkProfiles(profiles []string, appCtx *AppContext) error {
+	defined, err := appCtx.PackageDef.Profiles()
+	if err != nil {
+		return fmt.Errorf("failed to list profiles: %w", err)
+	}
+	for _, profile := range profiles {
+		if !slices.Contains(defined, profile) {
+			return fmt.Errorf("unknown profile %q, there is no profiles/%s/ directory", profile, profile)
+		}
+	}
+	return nil
+}
+
+// ListProfiles prints every defined profile and whether it is enabled for the host
+func ListProfiles(host string, appCtx *AppContext) error {
+	hostname, err := currentHostname(host)
+	if err != nil {
+		return err
+	}
+
+	defined, err := appCtx.PackageDef.Profiles()
+	if err != nil {
+		return fmt.Errorf("failed to list profiles: %w", err)
+	}
+	enabled, err := enabledProfiles(hostname, nil, appCtx)
+	if err != nil {
+		return err
+	}
+
+	if len(defined) == 0 && len(enabled) == 0 {
+		fmt.Println("No profiles defined, create a profiles/<name>/ directory.")
+		return nil
+	}
+	for _, profile := range defined {
+		if slices.Contains(enabled, profile) {
+			fmt.Printf("%s (enabled on %s)\n", profile, hostname)
+		} else {
+			fmt.Println(profile)
+		}
+	}
+	for _, profile := range enabled {
+		if !slices.Contains(defined, profile) {
+			fmt.Printf("%s (enabled on %s, but not defined anymore)\n", profile, hostname)
+		}
+	}
+	return nil
+}
+
+// EnableProfiles persists profiles for the host, so that every sync loads them
+func EnableProfiles(profiles []string, host string, appCtx *AppContext) error {
+	if len(profiles) == 0 {
+		return fmt.Errorf("no profile given")
+	}
+	if err := checkProfiles(profiles, appCtx); err != nil {
+		return err
+	}
+
+	hostname, err := currentHostname(host)
+	if err != nil {
+		return err
+	}
+
+	for _, profile := range profiles {
+		err := appCtx.QueryClient.EnableHostProfile(context.Background(), database.EnableHostProfileParams{
+			Host:    hostname,
+			Profile: profile,
+		})
+		if err != nil {
+			return fmt.Errorf("failed to enable profile %s: %w", profile, err)
+		}
+		fmt.Printf("Enabled profile %s on %s, its packages are installed on the next sync\n", profile, hostname)
+	}
+	return nil
+}
+
+// DisableProfiles stops loading profiles on the host. Their packages are then
+// no longer desired, and removed on the next sync like any package dropped
+// from the definitions.
+func DisableProfiles(profiles []string, host string, appCtx *AppContext) error {
+	if len(profiles) == 0 {
+		return fmt.Errorf("no profile given")
+	}
+
+	hostname, err := currentHostname(host)
+	if err != nil {
+		return err
+	}
+
+	enabled, err := enabledProfiles(hostname, nil, appCtx)
+	if err != nil {
+		return err
+	}
+
+	for _, profile := range profiles {
+		if !slices.Contains(enabled, profile) {
+			return fmt.Errorf("profile %s is not enabled on %s", profile, hostname)
+		}
+		err := appCtx.QueryClient.DisableHostProfile(context.Background(), database.DisableHostProfileParams{
+			Host:    hostname,
+			Profile: profile,
+		})
+		if err != nil {
+			return fmt.Errorf("failed to disable profile %s: %w", profile, err)
+		}
+		fmt.Printf("Disabled profile %s on %s, its packages are removed on the next sync\n", profile, hostname)
+	}
+	return nil
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestHashDefinitionsCoversEnabledProfiles(t *testing.T) {
+	appCtx := newTestAppContext(t, "testdata/profiles")
+
+	hash := func(host string) string {
+		t.Helper()
+		h, err := hashDefinitions(host, appCtx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return h
+	}
+	before := hash("test-host")
+
+	if err := EnableProfiles([]string{"gaming"}, "test-host", appCtx); err != nil {
+		t.Fatal(err)
+	}
+	if hash("test-host") == before {
+		t.Error("hashDefinitions() did not change when a profile was enabled")
+	}
+	if hash("tower") != before {
+		t.Error("hashDefinitions() of tower should not depend on the profiles of test-host")
+	}
+}
+
+func TestProfilePrecedence(t *testing.T) {
+	tests := []struct {
+		name         string
+		files        map[string]string
+		wantPackages []string
+	}{
+		{
+			name:         "profile declaration wins over a host exclusion",
+			files:        map[string]string{"hosts/laptop.pkgs": "!steam\n", "profiles/gaming/games.pkgs": "steam\n"},
+			wantPackages: []string{"steam"},
+		},
+		{
+			name:         "profile exclusion wins over a host declaration",
+			files:        map[string]string{"hosts/laptop.pkgs": "discord\n", "profiles/gaming.pkgs": "!discord\n"},
+			wantPackages: nil,
+		},
+		{
+			name:         "disabled profiles are ignored",
+			files:        map[string]string{"base.pkgs": "git\n", "profiles/work/tools.pkgs": "slack\n!git\n"},
+			wantPackages: []string{"git"},
+		},
+	}
+
+	machine := Machine{Hostname: "laptop", Profiles: []string{"gaming"}}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			desired, _, err := buildDesiredPackagesFromDefs(loadTestDefinitions(t, tt.files), machine, noGroups{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := desiredNames(desired); !reflect.DeepEqual(got, tt.wantPackages) {
+				t.Errorf("packages = %v, want %v", got, tt.wantPackages)
+			}
+		})
+	}
+}
+
+func TestEnabledProfiles(t *testing.T) {
+	appCtx := newTestAppContext(t, "testdata/profiles")
+
+	enabled := func(host string, extra ...string) []string {
+		t.Helper()
+		profiles, err := enabledProfiles(host, extra, appCtx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return profiles
+	}
+
+	if got := enabled("test-host"); got != nil {
+		t.Errorf("profiles before enabling any = %v, want none", got)
+	}
+	if got, want := enabled("test-host", "gaming"), []string{"gaming"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("profiles for this run = %v, want %v", got, want)
+	}
+	if _, err := enabledProfiles("test-host", []string{"work"}, appCtx); err == nil {
+		t.Error("enabledProfiles() accepted an undefined profile")
+	}
+
+	if err := EnableProfiles([]string{"gaming"}, "test-host", appCtx); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := enabled("test-host", "gaming"), []string{"gaming"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("profiles after enabling gaming = %v, want %v", got, want)
+	}
+	if got := enabled("tower"); got != nil {
+		t.Errorf("profiles of tower = %v, want none", got)
+	}
+	if err := EnableProfiles([]string{"work"}, "test-host", appCtx); err == nil {
+		t.Error("EnableProfiles() accepted an undefined profile")
+	}
+
+	if err := DisableProfiles([]string{"gaming"}, "tower", appCtx); err == nil {
+		t.Error("DisableProfiles() accepted a profile that is not enabled")
+	}
+	if err := DisableProfiles([]string{"gaming"}, "test-host", appCtx); err != nil {
+		t.Fatal(err)
+	}
+	if got := enabled("test-host"); got != nil {
+		t.Errorf("profiles after disabling gaming = %v, want none", got)
+	}
+}
+
+func TestMachineCoversProfiles(t *testing.T) {
+	machine := Machine{Hostname: "laptop", Roles: []string{"portable"}, Profiles: []string{"gaming"}}
+	for scope, want := range map[string]bool{
+		globalScope:      true,
+		"laptop":         true,
+		"role:portable":  true,
+		"profile:gaming": true,
+		"profile:work":   false,
+		// A host named like a profile is not the profile
+		"gaming": false,
+	} {
+		if got := machine.Covers(scope); got != want {
+			t.Errorf("Covers(%q) = %v, want %v", scope, got, want)
+		}
+	}
+}
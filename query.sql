@@ -1,130 +1,221 @@
 -- name: GetPackages :many
 SELECT
     id,
-    name,
-    host
+    host,
+    scope,
+    name
 FROM
     packages
 ORDER BY
     name;
 
--- name: GetPackageByName :one
-SELECT
-    id,
-    name,
-    host
-FROM
-    packages
-WHERE
-    name = ?;
-
 -- name: GetPackageByNameAndHost :one
 SELECT
     id,
-    name,
-    host
+    host,
+    scope,
+    name
 FROM
     packages
 WHERE
     name = ?
-    AND (
-        host = ?
-        OR (
-            host IS NULL
-            AND ? IS NULL
-        )
-    );
+    AND host = ?;
 
 -- name: CreatePackage :one
 INSERT INTO
-    packages (name, host)
-VALUES
-    (?, ?)
-RETURNING
-    id,
-    name,
-    host;
-
--- name: CreatePackageWithoutHost :one
-INSERT INTO
-    packages (name)
+    packages (host, scope, name)
 VALUES
-    (?)
+    (?, ?, ?)
 RETURNING
     id,
-    name,
-    host;
+    host,
+    scope,
+    name;
 
 -- name: UpsertPackage :one
 INSERT INTO
-    packages (name, host)
+    packages (host, scope, name)
 VALUES
-    (?, ?) ON CONFLICT (name, host) DO
-UPDATE
-SET
-    name = EXCLUDED.name,
-    host = EXCLUDED.host
-RETURNING
-    id,
-    name,
-    host;
-
--- name: UpsertPackageWithoutHost :one
-INSERT INTO
-    packages (name)
-VALUES
-    (?) ON CONFLICT (name) DO
+    (?, ?, ?) ON CONFLICT (host, scope, name) DO
 UPDATE
 SET
     name = EXCLUDED.name
 RETURNING
     id,
-    name,
-    host;
-
--- name: DeletePackage :exec
-DELETE FROM
-    packages
-WHERE
-    name = ?;
+    host,
+    scope,
+    name;
 
 -- name: DeletePackageByNameAndHost :exec
 DELETE FROM
     packages
 WHERE
     name = ?
-    AND (
-        host = ?
-        OR (
-            host IS NULL
-            AND ? IS NULL
-        )
-    );
+    AND host = ?;
 
 -- name: GetPackagesByHost :many
 SELECT
     id,
-    name,
-    host
+    host,
+    scope,
+    name
 FROM
     packages
 WHERE
-    (
-        host = ?
-        OR (
-            host IS NULL
-            AND ? IS NULL
-        )
-    );
+    host = ?
+ORDER BY
+    name;
 
 -- name: DeletePackagesByHost :exec
 DELETE FROM
     packages
 WHERE
-    (
-        host = ?
-        OR (
-            host IS NULL
-            AND ? IS NULL
-        )
-    );
+    host = ?;
+
+-- name: CreateTransaction :one
+INSERT INTO
+    transactions (
+        started_at,
+        duration_ms,
+        host,
+        flags,
+        install_args,
+        remove_args,
+        status,
+        error
+    )
+VALUES
+    (?, ?, ?, ?, ?, ?, ?, ?)
+RETURNING
+    id,
+    started_at,
+    duration_ms,
+    host,
+    flags,
+    install_args,
+    remove_args,
+    status,
+    error;
+
+-- name: CreateTransactionChange :exec
+INSERT INTO
+    transaction_changes (transaction_id, action, package, status, version)
+VALUES
+    (?, ?, ?, ?, ?);
+
+-- name: ListTransactions :many
+SELECT
+    t.id,
+    t.started_at,
+    t.duration_ms,
+    t.host,
+    t.flags,
+    t.status,
+    COUNT(c.id) AS change_count
+FROM
+    transactions t
+    LEFT JOIN transaction_changes c ON c.transaction_id = t.id
+GROUP BY
+    t.id
+ORDER BY
+    t.id DESC
+LIMIT
+    ?;
+
+-- name: GetTransaction :one
+SELECT
+    id,
+    started_at,
+    duration_ms,
+    host,
+    flags,
+    install_args,
+    remove_args,
+    status,
+    error
+FROM
+    transactions
+WHERE
+    id = ?;
+
+-- name: GetTransactionChanges :many
+SELECT
+    id,
+    transaction_id,
+    action,
+    package,
+    status,
+    version
+FROM
+    transaction_changes
+WHERE
+    transaction_id = ?
+ORDER BY
+    id;
+
+-- name: GetLatestRollbackableTransaction :one
+SELECT
+    id,
+    started_at,
+    duration_ms,
+    host,
+    flags,
+    install_args,
+    remove_args,
+    status,
+    error
+FROM
+    transactions t
+WHERE
+    host = ?
+    AND EXISTS (
+        SELECT
+            1
+        FROM
+            transaction_changes c
+        WHERE
+            c.transaction_id = t.id
+            AND c.status = 'succeeded'
+    )
+ORDER BY
+    id DESC
+LIMIT
+    1;
+
+-- name: ListKnownHosts :many
+SELECT
+    host
+FROM
+    packages
+WHERE
+    host != ''
+UNION
+SELECT
+    host
+FROM
+    transactions
+ORDER BY
+    host;
+
+-- name: ListHostProfiles :many
+SELECT
+    profile
+FROM
+    host_profiles
+WHERE
+    host = ?
+ORDER BY
+    profile;
+
+-- name: EnableHostProfile :exec
+INSERT INTO
+    host_profiles (host, profile)
+VALUES
+    (?, ?) ON CONFLICT (host, profile) DO NOTHING;
+
+-- name: DisableHostProfile :exec
+DELETE FROM
+    host_profiles
+WHERE
+    host = ?
+    AND profile = ?;
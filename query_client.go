@@ -3,7 +3,6 @@ package main
 import (
 	"context"
 	"database/sql"
-	_ "embed"
 	"log"
 	"path/filepath"
 	"sync"
@@ -13,12 +12,9 @@ import (
 	_ "modernc.org/sqlite"
 )
 
-//go:embed schema.sql
-var ddl string
-
 var (
 	queries *database.Queries
-	once        sync.Once
+	once    sync.Once
 )
 
 func NewQueryClient() *database.Queries {
@@ -28,7 +24,7 @@ func NewQueryClient() *database.Queries {
 		if err != nil {
 			log.Fatal(err)
 		}
-		if _, err := db.ExecContext(ctx, ddl); err != nil {
+		if err := migrate(ctx, db); err != nil {
 			log.Fatal(err)
 		}
 		queries = database.New(db)
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+)
+
+type ResolveOptions struct {
+	// Host is the host to resolve the definitions for, this machine when empty
+	Host string
+	// Profiles are enabled on top of the ones persisted for the host
+	Profiles []string
+	Output   OutputFormat
+}
+
+// ResolvedPackage is a package of the effective set of a host
+type ResolvedPackage struct {
+	Name string `json:"name" yaml:"name"`
+	// Group is set when the package is only wanted as a member of a "@group" entry
+	Group string `json:"group,omitempty" yaml:"group,omitempty"`
+	// Origins tell the kind of files declaring the package: global, host <name> or role <name>
+	Origins []string        `json:"origins" yaml:"origins"`
+	Sources []PackageSource `json:"sources" yaml:"sources"`
+}
+
+// ExcludedPackage is a package a "!pkg" line removed from the effective set
+type ExcludedPackage struct {
+	Name   string        `json:"name" yaml:"name"`
+	Source PackageSource `json:"source" yaml:"source"`
+}
+
+// ResolveReport is the effective package set of a host, as printed by "ditto resolve"
+type ResolveReport struct {
+	FormatVersion int      `json:"format_version" yaml:"format_version"`
+	Host          string   `json:"host" yaml:"host"`
+	Roles         []string `json:"roles" yaml:"roles"`
+	Profiles      []string `json:"profiles" yaml:"profiles"`
+	// FactsKnown is false when the [if] blocks could not be evaluated, their
+	// entries then tell their conditions in "when"
+	FactsKnown bool              `json:"facts_known" yaml:"facts_known"`
+	Packages   []ResolvedPackage `json:"packages" yaml:"packages"`
+	Excluded   []ExcludedPackage `json:"excluded" yaml:"excluded"`
+}
+
+// Resolve prints the packages the definitions request for a host, without
+// looking at what is installed
+func Resolve(opts ResolveOptions, appCtx *AppContext) error {
+	defs, err := appCtx.PackageDef.LoadAllDefinitions()
+	if err != nil {
+		return fmt.Errorf("failed to load package definitions: %w", err)
+	}
+
+	hostname, err := currentHostname(opts.Host)
+	if err != nil {
+		return err
+	}
+
+	machine, err := newMachine(hostname, opts.Profiles, appCtx)
+	if err != nil {
+		return err
+	}
+	warnAmbiguousHostPatterns(defs, hostname)
+
+	desired, excluded, err := buildDesiredPackagesFromDefs(defs, machine, appCtx.Pacman)
+	if err != nil {
+		return fmt.Errorf("failed to resolve desired packages: %w", err)
+	}
+
+	report := newResolveReport(machine, defs, desired, excluded)
+	if opts.Output.Structured() {
+		return writeReport(os.Stdout, opts.Output, report)
+	}
+
+	var out bytes.Buffer
+	fmt.Fprintf(&out, "%d package(s) for %s", len(report.Packages), report.Host)
+	if len(report.Roles) > 0 {
+		fmt.Fprintf(&out, " (roles: %s)", strings.Join(report.Roles, ", "))
+	}
+	if len(report.Profiles) > 0 {
+		fmt.Fprintf(&out, " (profiles: %s)", strings.Join(report.Profiles, ", "))
+	}
+	out.WriteString("\n")
+	if !report.FactsKnown {
+		fmt.Fprintf(&out, "The facts of %s are unknown, [if] blocks are listed with their conditions instead of being evaluated.\n", report.Host)
+	}
+	if len(report.Packages) > 0 {
+		out.WriteString(buildResolveTable(report.Packages).String())
+		out.WriteString("\n")
+	}
+	for _, pkg := range report.Excluded {
+		fmt.Fprintf(&out, "Excluded %s in %s%s\n", pkg.Name, pkg.Source, describeWhen(pkg.Source))
+	}
+	displayWithOptionalPager(appCtx, &out)
+	return nil
+}
+
+func newResolveReport(machine Machine, defs []Definition, desired []DesiredPackage, excluded map[string]PackageSource) ResolveReport {
+	scopes := make(map[string]string, len(defs))
+	for _, def := range defs {
+		scopes[def.File] = def.Scope()
+	}
+
+	report := ResolveReport{
+		FormatVersion: reportFormatVersion,
+		Host:          machine.Hostname,
+		Roles:         nonNil(machine.Roles),
+		Profiles:      nonNil(machine.Profiles),
+		FactsKnown:    machine.Facts != nil,
+		Packages:      []ResolvedPackage{},
+		Excluded:      []ExcludedPackage{},
+	}
+
+	for _, pkg := range desired {
+		resolved := ResolvedPackage{Name: pkg.Name, Group: pkg.Group, Sources: pkg.Sources}
+		for _, source := range pkg.Sources {
+			resolved.Origins = appendUnique(resolved.Origins, originLabel(scopes[source.File]))
+		}
+		report.Packages = append(report.Packages, resolved)
+	}
+
+	for name, source := range excluded {
+		report.Excluded = append(report.Excluded, ExcludedPackage{Name: name, Source: source})
+	}
+	sort.Slice(report.Excluded, func(i, j int) bool {
+		return report.Excluded[i].Name < report.Excluded[j].Name
+	})
+
+	return report
+}
+
+// originLabel tells the kind of file a scope comes from
+func originLabel(scope string) string {
+	if scope == globalScope {
+		return "global"
+	}
+	return scopeLabel(scope)
+}
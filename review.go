@@ -0,0 +1,360 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/charmbracelet/x/term"
+)
+
+// reviewFilters are the actions the review screen can be filtered on, "" for all
+var reviewFilters = []ChangeAction{"", ActionInstall, ActionMarkExplicit, ActionDemote, ActionRemoveUnmanaged}
+
+// reviewRow is a change of the review screen
+type reviewRow struct {
+	ChangeRow
+	Sources  []PackageSource
+	Selected bool
+	// KeepIn is the definition file a removal is added back to instead of being applied
+	KeepIn string
+}
+
+// reviewModel is the review screen of "ditto sync -i"
+type reviewModel struct {
+	rows         []reviewRow
+	descriptions map[string]string
+	// files are the definition files removals can be sent back to
+	files []string
+	// sourceFiles are the files rows can be filtered on, "" for all
+	sourceFiles  []string
+	actionFilter int
+	sourceFilter int
+	cursor       int
+	picking      bool
+	pickCursor   int
+	height       int
+	aborted      bool
+}
+
+var (
+	reviewTitleStyle  = lipgloss.NewStyle().Bold(true)
+	reviewCursorStyle = lipgloss.NewStyle().Bold(true).Foreground(lipgloss.Color("15"))
+	reviewDimStyle    = lipgloss.NewStyle().Foreground(lipgloss.Color("8"))
+	reviewKeepStyle   = lipgloss.NewStyle().Foreground(lipgloss.Color("12"))
+)
+
+// reviewSync lets the user pick the changes to apply in a full-screen review,
+// and adds the removals they send back to their definition file
+func reviewSync(appCtx *AppContext, state *SyncState, opts *SyncOptions) error {
+	if !term.IsTerminal(os.Stdin.Fd()) || !term.IsTerminal(os.Stdout.Fd()) {
+		return errors.New("the review screen needs a terminal, use --confirm-each instead")
+	}
+
+	descriptions := make(map[string]string)
+	if available, err := appCtx.Pacman.ListAvailable(); err == nil {
+		for _, pkg := range available {
+			descriptions[pkg.Name] = pkg.Description
+		}
+	}
+	for _, pkg := range state.Installed {
+		descriptions[pkg.Name] = pkg.Description
+	}
+
+	final, err := tea.NewProgram(newReviewModel(state, opts.Strict, descriptions), tea.WithAltScreen()).Run()
+	if err != nil {
+		return fmt.Errorf("review screen failed: %w", err)
+	}
+	model := final.(reviewModel)
+
+	selected := PackageDiff{Desired: state.Diff.Desired}
+	opts.Selected = &selected
+	if model.aborted {
+		return nil
+	}
+
+	for _, row := range model.rows {
+		if row.KeepIn != "" {
+			if err := keepPackage(appCtx, state, row.Package, row.KeepIn, opts.DryRun); err != nil {
+				return err
+			}
+			continue
+		}
+		if !row.Selected {
+			continue
+		}
+
+		switch row.Action {
+		case ActionInstall:
+			selected.ToAdd = append(selected.ToAdd, row.Package)
+		case ActionMarkExplicit:
+			selected.ToMarkExplicit = append(selected.ToMarkExplicit, row.Package)
+		case ActionDemote:
+			selected.ToRemove = append(selected.ToRemove, row.Package)
+		case ActionRemoveUnmanaged:
+			selected.ToRemoveFromDitto = append(selected.ToRemoveFromDitto, row.Package)
+		}
+	}
+
+	printPackageChanges(appCtx, selected, opts.Strict)
+	return nil
+}
+
+// keepPackage adds a package the sync would remove back to a definition file,
+// and makes it desired for the rest of the sync
+func keepPackage(appCtx *AppContext, state *SyncState, name, file string, dryRun bool) error {
+	if dryRun {
+		fmt.Printf("Would add %s to %s\n", name, file)
+	} else {
+		if err := appCtx.PackageDef.AppendPackage(file, name); err != nil {
+			return fmt.Errorf("failed to add %s to %s: %w", name, file, err)
+		}
+		fmt.Printf("Added %s to %s\n", name, file)
+	}
+
+	for _, def := range state.Definitions {
+		if def.File == file {
+			state.Desired = append(state.Desired, DesiredPackage{Name: name, Scopes: []string{def.ManagedScope(state.Hostname)}})
+			break
+		}
+	}
+	return nil
+}
+
+func newReviewModel(state *SyncState, strict bool, descriptions map[string]string) reviewModel {
+	m := reviewModel{
+		descriptions: descriptions,
+		sourceFiles:  []string{""},
+	}
+
+	for _, def := range state.Definitions {
+		m.files = append(m.files, def.File)
+	}
+
+	for _, row := range diffRows(state.Diff, strict) {
+		sources := state.Diff.Desired[row.Package].Sources
+		for _, source := range sources {
+			m.sourceFiles = appendUnique(m.sourceFiles, source.File)
+		}
+		m.rows = append(m.rows, reviewRow{ChangeRow: row, Sources: sources, Selected: true})
+	}
+
+	return m
+}
+
+func (m reviewModel) Init() tea.Cmd {
+	return nil
+}
+
+// visible returns the indexes of the rows matching the filters
+func (m reviewModel) visible() []int {
+	action := reviewFilters[m.actionFilter]
+	source := m.sourceFiles[m.sourceFilter]
+
+	var indexes []int
+	for i, row := range m.rows {
+		if action != "" && row.Action != action {
+			continue
+		}
+		if source != "" && !slices.ContainsFunc(row.Sources, func(s PackageSource) bool { return s.File == source }) {
+			continue
+		}
+		indexes = append(indexes, i)
+	}
+	return indexes
+}
+
+func (m reviewModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case tea.WindowSizeMsg:
+		m.height = msg.Height
+	case tea.KeyMsg:
+		if m.picking {
+			return m.updatePicker(msg)
+		}
+		return m.updateList(msg)
+	}
+	return m, nil
+}
+
+func (m reviewModel) updateList(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	visible := m.visible()
+
+	switch msg.String() {
+	case "ctrl+c", "q", "esc":
+		m.aborted = true
+		return m, tea.Quit
+	case "enter":
+		return m, tea.Quit
+	case "up", "k":
+		m.cursor = max(m.cursor-1, 0)
+	case "down", "j":
+		m.cursor = min(m.cursor+1, max(len(visible)-1, 0))
+	case "f":
+		m.actionFilter = (m.actionFilter + 1) % len(reviewFilters)
+		m.cursor = 0
+	case "s":
+		m.sourceFilter = (m.sourceFilter + 1) % len(m.sourceFiles)
+		m.cursor = 0
+	case "a":
+		all := true
+		for _, i := range visible {
+			all = all && m.rows[i].Selected
+		}
+		for _, i := range visible {
+			m.rows[i].Selected = !all
+			m.rows[i].KeepIn = ""
+		}
+	case " ", "x":
+		if len(visible) > 0 {
+			row := &m.rows[visible[m.cursor]]
+			row.Selected = !row.Selected
+			row.KeepIn = ""
+		}
+	case "m":
+		if len(visible) == 0 || len(m.files) == 0 {
+			break
+		}
+		row := &m.rows[visible[m.cursor]]
+		if row.Action != ActionDemote && row.Action != ActionRemoveUnmanaged {
+			break
+		}
+		if row.KeepIn != "" {
+			row.KeepIn = ""
+			row.Selected = true
+			break
+		}
+		m.picking = true
+		m.pickCursor = 0
+	}
+
+	return m, nil
+}
+
+func (m reviewModel) updatePicker(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	switch msg.String() {
+	case "ctrl+c":
+		m.aborted = true
+		return m, tea.Quit
+	case "esc", "q":
+		m.picking = false
+	case "up", "k":
+		m.pickCursor = max(m.pickCursor-1, 0)
+	case "down", "j":
+		m.pickCursor = min(m.pickCursor+1, len(m.files)-1)
+	case "enter":
+		row := &m.rows[m.visible()[m.cursor]]
+		row.KeepIn = m.files[m.pickCursor]
+		row.Selected = false
+		m.picking = false
+	}
+
+	return m, nil
+}
+
+func (m reviewModel) View() string {
+	if m.picking {
+		return m.pickerView()
+	}
+
+	var b strings.Builder
+	visible := m.visible()
+
+	selected := 0
+	for _, row := range m.rows {
+		if row.Selected {
+			selected++
+		}
+	}
+	fmt.Fprintln(&b, reviewTitleStyle.Render(fmt.Sprintf("Review changes — %d of %d selected", selected, len(m.rows))))
+
+	action, source := "all", "all"
+	if a := reviewFilters[m.actionFilter]; a != "" {
+		action, _ = actionLabel(a)
+	}
+	if s := m.sourceFiles[m.sourceFilter]; s != "" {
+		source = s
+	}
+	fmt.Fprintln(&b, reviewDimStyle.Render(fmt.Sprintf("action: %s   file: %s", action, source)))
+	fmt.Fprintln(&b)
+
+	// Keep the cursor in view when the list is taller than the screen
+	rows := len(visible)
+	if m.height > 0 {
+		rows = min(rows, max(m.height-9, 1))
+	}
+	start := min(max(m.cursor-rows+1, 0), max(len(visible)-rows, 0))
+
+	for n, i := range visible[start : start+rows] {
+		row := m.rows[i]
+		check := "[ ]"
+		if row.Selected {
+			check = "[x]"
+		}
+		label, color := actionLabel(row.Action)
+		line := fmt.Sprintf("%s %s %-28s %s",
+			check,
+			lipgloss.NewStyle().Foreground(color).Width(9).Render(label),
+			row.Package,
+			row.Reason,
+		)
+		if row.KeepIn != "" {
+			line += reviewKeepStyle.Render(" → keep in " + row.KeepIn)
+		}
+
+		if start+n == m.cursor {
+			fmt.Fprintln(&b, reviewCursorStyle.Render("> ")+line)
+		} else {
+			fmt.Fprintln(&b, "  "+line)
+		}
+	}
+	if len(visible) == 0 {
+		fmt.Fprintln(&b, reviewDimStyle.Render("  No change matches the filters."))
+	}
+
+	fmt.Fprintln(&b)
+	if len(visible) > 0 {
+		row := m.rows[visible[m.cursor]]
+		desc := m.descriptions[row.Package]
+		if desc == "" {
+			desc = "No description"
+		}
+		fmt.Fprintln(&b, desc)
+
+		var sources []string
+		for _, source := range row.Sources {
+			sources = append(sources, fmt.Sprintf("%s:%d", source.File, source.Line))
+		}
+		if len(sources) > 0 {
+			fmt.Fprintln(&b, reviewDimStyle.Render("Declared in "+strings.Join(sources, ", ")))
+		} else {
+			fmt.Fprintln(&b)
+		}
+	}
+
+	fmt.Fprint(&b, reviewDimStyle.Render(
+		"space toggle • a toggle all • f filter action • s filter file • m keep removal in a file • enter apply • q quit"))
+	return b.String()
+}
+
+func (m reviewModel) pickerView() string {
+	var b strings.Builder
+	row := m.rows[m.visible()[m.cursor]]
+
+	fmt.Fprintln(&b, reviewTitleStyle.Render(fmt.Sprintf("Keep %s in:", row.Package)))
+	fmt.Fprintln(&b)
+	for i, file := range m.files {
+		if i == m.pickCursor {
+			fmt.Fprintln(&b, reviewCursorStyle.Render("> "+file))
+		} else {
+			fmt.Fprintln(&b, "  "+file)
+		}
+	}
+	fmt.Fprintln(&b)
+	fmt.Fprint(&b, reviewDimStyle.Render("enter choose • esc cancel"))
+	return b.String()
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+const (
+	ROLES_EXTENSION = ".roles"
+	// rolePrefix marks the scope of role definitions, to tell them from host names
+	rolePrefix = "role:"
+)
+
+// hostEnv overrides the host name, for containers whose hostname is random
+const hostEnv = "DITTO_HOST"
+
+// currentHostname returns the host definitions are resolved for: the override
+// given with --host, else $DITTO_HOST, else the system host name
+func currentHostname(override string) (string, error) {
+	if override != "" {
+		return override, nil
+	}
+	if host := os.Getenv(hostEnv); host != "" {
+		return host, nil
+	}
+
+	hostname, err := os.Hostname()
+	if err != nil {
+		return "", fmt.Errorf("cannot get current hostname: %v", err)
+	}
+	return hostname, nil
+}
+
+// Machine is the host definitions are resolved for
+type Machine struct {
+	Hostname string
+	// Roles are the roles the host belongs to, from the config and hosts/<hostname>.roles
+	Roles []string
+	// Profiles are the profiles enabled for the host, persisted or for this run only
+	Profiles []string
+	// Facts are what was detected about the host, nil when they are unknown
+	Facts Facts
+}
+
+// newMachine returns the machine for a host, with its roles, the profiles
+// enabled for it plus the given ones, and its facts
+func newMachine(hostname string, profiles []string, appCtx *AppContext) (Machine, error) {
+	roles, err := appCtx.PackageDef.HostRoles(hostname)
+	if err != nil {
+		return Machine{}, fmt.Errorf("failed to read the roles of %s: %w", hostname, err)
+	}
+	roles = append(roles, appCtx.Config.Roles[hostname]...)
+	slices.Sort(roles)
+
+	enabled, err := enabledProfiles(hostname, profiles, appCtx)
+	if err != nil {
+		return Machine{}, err
+	}
+
+	return Machine{
+		Hostname: hostname,
+		Roles:    slices.Compact(roles),
+		Profiles: enabled,
+		Facts:    hostFacts(hostname, appCtx.Config),
+	}, nil
+}
+
+// hostFacts returns the facts of a host: read under its factsRoots entry of
+// the config, else from this machine when it is the host. Facts of other
+// hosts are unknown.
+func hostFacts(hostname string, cfg *Config) Facts {
+	if root, ok := cfg.FactsRoots[hostname]; ok {
+		return collectFacts(root)
+	}
+	if local, err := currentHostname(""); err == nil && local == hostname {
+		return collectFacts(cfg.FactsRoot)
+	}
+	return nil
+}
+
+// Covers reports whether definitions of the given scope apply to the machine
+func (m Machine) Covers(scope string) bool {
+	if role, ok := strings.CutPrefix(scope, rolePrefix); ok {
+		return slices.Contains(m.Roles, role)
+	}
+	if profile, ok := strings.CutPrefix(scope, profilePrefix); ok {
+		return slices.Contains(m.Profiles, profile)
+	}
+	return scope == globalScope || matchHost(scope, m.Hostname)
+}
+
+func roleScope(role string) string {
+	return rolePrefix + role
+}
+
+// scopeLabel describes a scope for messages
+func scopeLabel(scope string) string {
+	if scope == globalScope {
+		return "all hosts"
+	}
+	if role, ok := strings.CutPrefix(scope, rolePrefix); ok {
+		return "role " + role
+	}
+	if profile, ok := strings.CutPrefix(scope, profilePrefix); ok {
+		return "profile " + profile
+	}
+	return "host " + scope
+}
+
+// AllHostRoles returns the roles of every host that has some, from the config
+// and the hosts/*.roles files
+func (pd *PackageDef) AllHostRoles(cfg *Config) (map[string][]string, error) {
+	files, err := filepath.Glob(filepath.Join(pd.path, "hosts", "*"+ROLES_EXTENSION))
+	if err != nil {
+		return nil, err
+	}
+
+	hostRoles := make(map[string][]string)
+	for host, roles := range cfg.Roles {
+		hostRoles[host] = append(hostRoles[host], roles...)
+	}
+	for _, file := range files {
+		host := strings.TrimSuffix(filepath.Base(file), ROLES_EXTENSION)
+		roles, err := pd.HostRoles(host)
+		if err != nil {
+			return nil, err
+		}
+		hostRoles[host] = append(hostRoles[host], roles...)
+	}
+	return hostRoles, nil
+}
+
+// HostRoles reads the roles listed in hosts/<hostname>.roles, one per line
+func (pd *PackageDef) HostRoles(hostname string) ([]string, error) {
+	data, err := os.ReadFile(filepath.Join(pd.path, "hosts", hostname+ROLES_EXTENSION))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var roles []string
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		if role, _ := parseLine(scanner.Text()); role != "" {
+			roles = append(roles, role)
+		}
+	}
+	return roles, scanner.Err()
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestHashDefinitionsCoversRoles(t *testing.T) {
+	appCtx := newTestAppContext(t, "testdata/import")
+
+	hash := func() string {
+		t.Helper()
+		h, err := hashDefinitions("test-host", appCtx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return h
+	}
+	before := hash()
+	if hash() != before {
+		t.Fatal("hashDefinitions() is not stable")
+	}
+
+	rolesFile := filepath.Join(appCtx.PackageDef.path, "hosts", "test-host"+ROLES_EXTENSION)
+	if err := os.WriteFile(rolesFile, []byte("laptops\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	withRolesFile := hash()
+	if withRolesFile == before {
+		t.Error("hashDefinitions() did not change with a new .roles file")
+	}
+
+	appCtx.Config.Roles = map[string][]string{"test-host": {"gpu-nvidia"}}
+	if hash() == withRolesFile {
+		t.Error("hashDefinitions() did not change with the roles of the config")
+	}
+}
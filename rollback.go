@@ -0,0 +1,244 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/ony-boom/ditto/database"
+)
+
+type RollbackOptions struct {
+	// TransactionID is the sync to undo, 0 means the latest one of the host
+	TransactionID int64
+	// Host is the host whose sync is undone, this machine when empty
+	Host   string
+	DryRun bool
+	// Yes applies the rollback without asking for confirmation
+	Yes bool
+}
+
+// RollbackPackage is a removed package to reinstall, from the cache when possible
+type RollbackPackage struct {
+	Name    string
+	Version string
+	File    string
+}
+
+// RollbackPlan lists what undoing a sync does
+type RollbackPlan struct {
+	TransactionID int64
+	Reinstall     []RollbackPackage
+	Remove        []string
+	MarkExplicit  []string
+	MarkAsDeps    []string
+}
+
+func Rollback(opts RollbackOptions, appCtx *AppContext) error {
+	ctx := context.Background()
+	started := time.Now()
+
+	hostname, err := currentHostname(opts.Host)
+	if err != nil {
+		return err
+	}
+
+	tx, err := findRollbackTarget(ctx, appCtx.QueryClient, opts.TransactionID, hostname)
+	if err != nil {
+		return err
+	}
+
+	changes, err := appCtx.QueryClient.GetTransactionChanges(ctx, tx.ID)
+	if err != nil {
+		return fmt.Errorf("failed to get transaction changes: %w", err)
+	}
+
+	installedPackages, err := appCtx.Pacman.ListInstalled()
+	if err != nil {
+		return fmt.Errorf("failed to list installed packages: %w", err)
+	}
+
+	plan := planRollback(tx.ID, changes, installedPackages, appCtx.Pacman)
+	rows := plan.rows()
+	if len(rows) == 0 {
+		fmt.Printf("Nothing to roll back for sync #%d.\n", tx.ID)
+		return nil
+	}
+
+	printChangeRows(appCtx, rows)
+
+	if opts.DryRun {
+		fmt.Println("Dry run mode — no changes made")
+		return nil
+	}
+
+	result, applyErr := applyRollback(plan, opts, appCtx.Pacman)
+	if len(result.Changes) > 0 && !result.Aborted {
+		after, err := appCtx.Pacman.ListInstalled()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: failed to list installed packages, the history won't have their new versions: %v\n", err)
+		}
+		result.fillVersions(installedPackages, after)
+	}
+
+	info := TransactionInfo{
+		Started: started,
+		Host:    hostname,
+		Flags:   []string{"rollback=" + strconv.FormatInt(tx.ID, 10)},
+	}
+	if err := recordTransaction(ctx, appCtx.QueryClient, info, result, applyErr); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+	}
+
+	return applyErr
+}
+
+func findRollbackTarget(ctx context.Context, queries *database.Queries, id int64, hostname string) (database.Transaction, error) {
+	if id == 0 {
+		tx, err := queries.GetLatestRollbackableTransaction(ctx, hostname)
+		if errors.Is(err, sql.ErrNoRows) {
+			return tx, fmt.Errorf("no sync to roll back on %s", hostname)
+		}
+		return tx, err
+	}
+
+	tx, err := queries.GetTransaction(ctx, id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return tx, fmt.Errorf("no sync with id %d", id)
+	}
+	if err != nil {
+		return tx, err
+	}
+	// Undoing the sync of another machine would remove and reinstall the wrong packages
+	if tx.Host != hostname {
+		return tx, fmt.Errorf("sync #%d ran on %s, not on %s", id, tx.Host, hostname)
+	}
+	return tx, nil
+}
+
+// planRollback inverts the succeeded changes of a sync, skipping the ones the
+// system no longer reflects (e.g. an installed package that was removed since)
+func planRollback(id int64, changes []database.TransactionChange, installed []InstalledPackage, pacman *Pacman) RollbackPlan {
+	current := make(map[string]InstalledPackage, len(installed))
+	for _, pkg := range installed {
+		current[pkg.Name] = pkg
+	}
+
+	plan := RollbackPlan{TransactionID: id}
+	for _, change := range changes {
+		if ChangeStatus(change.Status) != StatusSucceeded {
+			continue
+		}
+
+		pkg, isInstalled := current[change.Package]
+		switch ChangeAction(change.Action) {
+		case ActionInstall:
+			if isInstalled {
+				plan.Remove = append(plan.Remove, change.Package)
+			}
+		case ActionRemove, ActionRemoveUnmanaged:
+			if !isInstalled {
+				reinstall := RollbackPackage{Name: change.Package, Version: change.Version.String}
+				if change.Version.Valid {
+					reinstall.File = pacman.CachedPackage(change.Package, change.Version.String)
+				}
+				plan.Reinstall = append(plan.Reinstall, reinstall)
+			}
+		case ActionDemote:
+			if isInstalled && pkg.Reason == ReasonDependency {
+				plan.MarkExplicit = append(plan.MarkExplicit, change.Package)
+			}
+		case ActionMarkExplicit:
+			if isInstalled && pkg.Reason == ReasonExplicit {
+				plan.MarkAsDeps = append(plan.MarkAsDeps, change.Package)
+			}
+		}
+	}
+
+	return plan
+}
+
+// rows describes the plan for the changes table
+func (plan RollbackPlan) rows() []ChangeRow {
+	var rows []ChangeRow
+	syncRef := fmt.Sprintf("sync #%d", plan.TransactionID)
+
+	for _, pkg := range plan.Reinstall {
+		reason := fmt.Sprintf("Removed by %s, from repos", syncRef)
+		if pkg.File != "" {
+			reason = fmt.Sprintf("Removed by %s, cached %s", syncRef, pkg.Version)
+		}
+		rows = append(rows, ChangeRow{ActionInstall, pkg.Name, reason})
+	}
+	for _, pkg := range plan.Remove {
+		rows = append(rows, ChangeRow{ActionRemove, pkg, "Installed by " + syncRef})
+	}
+	for _, pkg := range plan.MarkExplicit {
+		rows = append(rows, ChangeRow{ActionMarkExplicit, pkg, "Demoted by " + syncRef})
+	}
+	for _, pkg := range plan.MarkAsDeps {
+		rows = append(rows, ChangeRow{ActionDemote, pkg, "Marked explicit by " + syncRef})
+	}
+
+	return rows
+}
+
+func applyRollback(plan RollbackPlan, opts RollbackOptions, pm PackageManager) (*ApplyResult, error) {
+	result := &ApplyResult{}
+	for _, row := range plan.rows() {
+		result.Changes = append(result.Changes, Change{Action: row.Action, Package: row.Package, Status: StatusPlanned})
+	}
+	defer result.skipRemaining()
+
+	if !opts.Yes {
+		ok, err := confirm("Proceed with the rollback?")
+		if err != nil {
+			return result, err
+		}
+		if !ok {
+			fmt.Println("Aborted.")
+			result.Aborted = true
+			return result, nil
+		}
+	}
+
+	var files, fileNames, fromRepos []string
+	for _, pkg := range plan.Reinstall {
+		if pkg.File != "" {
+			files = append(files, pkg.File)
+			fileNames = append(fileNames, pkg.Name)
+		} else {
+			fromRepos = append(fromRepos, pkg.Name)
+		}
+	}
+
+	steps := []struct {
+		action ChangeAction
+		pkgs   []string
+		run    func() error
+	}{
+		{ActionInstall, fileNames, func() error { return pm.InstallFiles(files) }},
+		{ActionInstall, fromRepos, func() error { return pm.Install(fromRepos) }},
+		{ActionRemove, plan.Remove, func() error { return pm.Remove(plan.Remove) }},
+		{ActionMarkExplicit, plan.MarkExplicit, func() error { return pm.MarkExplicit(plan.MarkExplicit) }},
+		{ActionDemote, plan.MarkAsDeps, func() error { return pm.MarkAsDeps(plan.MarkAsDeps) }},
+	}
+
+	for _, step := range steps {
+		if len(step.pkgs) == 0 {
+			continue
+		}
+		err := step.run()
+		result.settle(step.action, step.pkgs, err)
+		if err != nil {
+			return result, fmt.Errorf("rollback failed: %w", err)
+		}
+	}
+
+	fmt.Println("Rollback applied.")
+	return result, nil
+}
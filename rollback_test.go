@@ -0,0 +1,116 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/ony-boom/ditto/database"
+)
+
+func TestPlanRollback(t *testing.T) {
+	cacheDir := t.TempDir()
+	for _, file := range []string{"vim-9.1-1-x86_64.pkg.tar.zst", "vim-9.1-1-x86_64.pkg.tar.zst.sig"} {
+		if err := os.WriteFile(filepath.Join(cacheDir, file), nil, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	pacman := NewPacman(&Config{DBPath: "testdata/pacman", CacheDir: cacheDir})
+	installed, err := pacman.ListInstalled()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	change := func(action ChangeAction, pkg string, status ChangeStatus, version string) database.TransactionChange {
+		return database.TransactionChange{
+			Action:  string(action),
+			Package: pkg,
+			Status:  string(status),
+			Version: sql.NullString{String: version, Valid: version != ""},
+		}
+	}
+	changes := []database.TransactionChange{
+		change(ActionInstall, "zsh", StatusSucceeded, "5.9-5"),
+		// Removed since the sync
+		change(ActionInstall, "neovim", StatusSucceeded, "0.10.0-1"),
+		change(ActionInstall, "fd", StatusFailed, ""),
+		change(ActionRemove, "vim", StatusSucceeded, "9.1-1"),
+		change(ActionRemoveUnmanaged, "nano", StatusSucceeded, "7.2-1"),
+		// Reinstalled since the sync
+		change(ActionRemove, "bash", StatusSucceeded, "5.2.026-2"),
+		change(ActionRemove, "tlp", StatusSkipped, ""),
+		change(ActionDemote, "groff", StatusSucceeded, ""),
+		// Marked explicit again since the sync
+		change(ActionDemote, "man-db", StatusSucceeded, ""),
+		change(ActionMarkExplicit, "zsh", StatusSucceeded, ""),
+		// Demoted again since the sync
+		change(ActionMarkExplicit, "bash", StatusSucceeded, ""),
+	}
+
+	plan := planRollback(42, changes, installed, pacman)
+
+	want := RollbackPlan{
+		TransactionID: 42,
+		Reinstall: []RollbackPackage{
+			{Name: "vim", Version: "9.1-1", File: filepath.Join(cacheDir, "vim-9.1-1-x86_64.pkg.tar.zst")},
+			{Name: "nano", Version: "7.2-1"},
+		},
+		Remove:       []string{"zsh"},
+		MarkExplicit: []string{"groff"},
+		MarkAsDeps:   []string{"zsh"},
+	}
+	if !reflect.DeepEqual(plan, want) {
+		t.Errorf("planRollback() = %+v, want %+v", plan, want)
+	}
+
+	rows := plan.rows()
+	wantRows := []ChangeRow{
+		{ActionInstall, "vim", "Removed by sync #42, cached 9.1-1"},
+		{ActionInstall, "nano", "Removed by sync #42, from repos"},
+		{ActionRemove, "zsh", "Installed by sync #42"},
+		{ActionMarkExplicit, "groff", "Demoted by sync #42"},
+		{ActionDemote, "zsh", "Marked explicit by sync #42"},
+	}
+	if !reflect.DeepEqual(rows, wantRows) {
+		t.Errorf("rows() = %+v, want %+v", rows, wantRows)
+	}
+}
+
+func TestFindRollbackTarget(t *testing.T) {
+	ctx := context.Background()
+	appCtx := newTestAppContext(t, "")
+	queries := appCtx.QueryClient
+
+	record := func(host string, status ChangeStatus) {
+		t.Helper()
+		result := &ApplyResult{Changes: []Change{{Action: ActionInstall, Package: "git", Status: status}}}
+		if err := recordTransaction(ctx, queries, TransactionInfo{Started: time.Now(), Host: host}, result, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	record("laptop", StatusSucceeded) // #1
+	record("tower", StatusSucceeded)  // #2
+	record("laptop", StatusFailed)    // #3, nothing to undo
+
+	tx, err := findRollbackTarget(ctx, queries, 0, "laptop")
+	if err != nil || tx.ID != 1 {
+		t.Errorf("latest sync of laptop = #%d (%v), want #1", tx.ID, err)
+	}
+	if tx, err := findRollbackTarget(ctx, queries, 2, "tower"); err != nil || tx.ID != 2 {
+		t.Errorf("sync #2 of tower = #%d (%v), want #2", tx.ID, err)
+	}
+
+	if _, err := findRollbackTarget(ctx, queries, 2, "laptop"); err == nil {
+		t.Error("findRollbackTarget() accepted a sync of tower on laptop")
+	}
+	if _, err := findRollbackTarget(ctx, queries, 99, "laptop"); err == nil {
+		t.Error("findRollbackTarget() accepted an unknown sync")
+	}
+	if _, err := findRollbackTarget(ctx, queries, 0, "desktop"); err == nil {
+		t.Error("findRollbackTarget() found a sync for a host that never synced")
+	}
+}
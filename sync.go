@@ -3,21 +3,31 @@ package main
 import (
 	"bytes"
 	"context"
-	"database/sql"
+	"errors"
 	"fmt"
-	"log"
 	"os"
 	"slices"
 	"sort"
 	"strings"
+	"time"
 
+	"github.com/charmbracelet/x/term"
 	"github.com/ony-boom/ditto/database"
 )
 
+type GroupResolver interface {
+	GroupMembers(group string) ([]string, error)
+}
+
 type PackageManager interface {
-	ListInstalled() ([]string, error)
+	GroupResolver
+	ListInstalled() ([]InstalledPackage, error)
+	ListOrphans() ([]string, error)
 	Install(pkgs []string, args ...string) error
+	InstallFiles(paths []string, args ...string) error
 	Remove(pkgs []string, args ...string) error
+	MarkExplicit(pkgs []string) error
+	MarkAsDeps(pkgs []string) error
 }
 
 type PackageDefLoader interface {
@@ -25,16 +35,78 @@ type PackageDefLoader interface {
 }
 
 type SyncOptions struct {
-	DryRun      bool
-	Strict      bool
+	DryRun bool
+	Strict bool
+	// FromPlan is set when the sync runs a plan file made by "ditto plan"
+	FromPlan    bool
 	InstallArgs []string
 	RemoveArgs  []string
+	Output      OutputFormat
+	// Yes applies the changes without asking for confirmation
+	Yes bool
+	// ConfirmEach asks for every change separately instead of once for all
+	ConfirmEach bool
+	// Interactive opens the review screen to pick the changes to apply
+	Interactive bool
+	// Selected, when set, is the part of the diff already approved in the review screen
+	Selected *PackageDiff
+	// Host resolves the definitions for another host than this machine
+	Host string
+	// Profiles are enabled for this run, on top of the ones persisted for the host
+	Profiles []string
+}
+
+// DesiredPackage is a package requested by the definitions
+type DesiredPackage struct {
+	Name string
+	// Group is set when the package is only wanted as a member of a "@group" entry.
+	Group string
+	// Scopes lists where the package is declared: a host name for host-specific
+	// definitions, globalScope for global ones.
+	Scopes []string
+	// Provides is set when the package is an installed provider of a virtual name
+	// listed in the definitions (e.g. jre-openjdk for java-runtime).
+	Provides string
+	// Sources lists the definition lines that request the package
+	Sources []PackageSource
 }
 
+// globalScope is the scope recorded for packages declared in global definitions
+const globalScope = ""
+
+// unclaimedHost holds the records of global packages migrated from a database
+// that knew no host, adopted by each host on its first sync
+const unclaimedHost = ""
+
 type PackageDiff struct {
-	ToAdd             []string
+	ToAdd []string
+	// ToRemove holds explicitly installed packages that are not in the definitions.
+	// In strict mode they are demoted to dependencies and removed once orphaned.
 	ToRemove          []string
 	ToRemoveFromDitto []string
+	// ToMarkExplicit holds desired packages that are only installed as dependencies.
+	ToMarkExplicit []string
+	// Desired indexes the desired packages by name, to explain the changes.
+	Desired map[string]DesiredPackage
+	// Excluded indexes the "!pkg" lines removing packages from the host's set, by package
+	Excluded map[string]PackageSource
+}
+
+// HasChanges reports whether applying the diff would touch the system
+func (d PackageDiff) HasChanges(strict bool) bool {
+	return len(d.ToAdd) > 0 ||
+		(strict && (len(d.ToRemove) > 0 || len(d.ToMarkExplicit) > 0)) ||
+		len(d.ToRemoveFromDitto) > 0
+}
+
+// SyncState is everything a sync computes before touching the system
+type SyncState struct {
+	Hostname string
+	// Definitions are the definitions that apply to the host
+	Definitions []Definition
+	Installed   []InstalledPackage
+	Desired     []DesiredPackage
+	Diff        PackageDiff
 }
 
 func Sync(
@@ -42,88 +114,300 @@ func Sync(
 	appCtx *AppContext,
 ) error {
 	ctx := context.Background()
+	started := time.Now()
+
+	stdout, restore := reserveStdout(opts.Output)
+	defer restore()
+
+	state, err := prepareSync(ctx, opts, appCtx)
+	if err != nil {
+		return err
+	}
+
+	report := newSyncReport(state, opts)
+	if opts.Interactive && state.Diff.HasChanges(opts.Strict) {
+		if err := reviewSync(appCtx, state, &opts); err != nil {
+			return err
+		}
+	} else if !opts.Output.Structured() {
+		printPackageChanges(appCtx, state.Diff, opts.Strict)
+	}
+
+	var applyErr error
+	if opts.DryRun {
+		fmt.Println("Dry run mode — no changes made")
+	} else {
+		var result *ApplyResult
+		result, applyErr = executeSync(ctx, appCtx, state, opts, started)
+		report.settle(result, applyErr)
+	}
+
+	if opts.Output.Structured() {
+		if err := writeReport(stdout, opts.Output, report); err != nil {
+			return err
+		}
+	}
+
+	return applyErr
+}
+
+// Status shows what a sync would change, without applying anything
+func Status(opts SyncOptions, appCtx *AppContext) error {
+	state, err := prepareSync(context.Background(), opts, appCtx)
+	if err != nil {
+		return err
+	}
+
+	if opts.Output.Structured() {
+		opts.DryRun = true
+		return writeReport(os.Stdout, opts.Output, newSyncReport(state, opts))
+	}
+
+	if !state.Diff.HasChanges(opts.Strict) {
+		fmt.Println("Everything is in sync.")
+		return nil
+	}
+	printPackageChanges(appCtx, state.Diff, opts.Strict)
+	return nil
+}
 
+// prepareSync loads the definitions and the installed packages and computes the
+// diff for the host and profiles of opts
+func prepareSync(ctx context.Context, opts SyncOptions, appCtx *AppContext) (*SyncState, error) {
 	installedPackages, err := appCtx.Pacman.ListInstalled()
 	if err != nil {
-		return fmt.Errorf("failed to list installed packages: %w", err)
+		return nil, fmt.Errorf("failed to list installed packages: %w", err)
 	}
 
 	defs, err := appCtx.PackageDef.LoadAllDefinitions()
 	if err != nil {
-		return fmt.Errorf("failed to load package definitions: %w", err)
+		return nil, fmt.Errorf("failed to load package definitions: %w", err)
+	}
+
+	hostname, err := currentHostname(opts.Host)
+	if err != nil {
+		return nil, err
 	}
 
-	hostname, err := os.Hostname()
+	machine, err := newMachine(hostname, opts.Profiles, appCtx)
 	if err != nil {
-		return fmt.Errorf("cannot get current hostname: %v", err)
+		return nil, err
+	}
+
+	warnAmbiguousHostPatterns(defs, hostname)
+	hostDefs := definitionsFor(defs, machine)
+	if machine.Facts == nil && slices.ContainsFunc(hostDefs, Definition.Conditional) {
+		return nil, fmt.Errorf("the facts of %s are unknown, add its facts directory to factsRoots in the config to evaluate its [if] blocks", hostname)
+	}
+	if err := checkDefinitions(hostDefs, installedPackages, appCtx); err != nil {
+		return nil, err
 	}
 
-	desiredPackages := buildDesiredPackagesFromDefs(defs)
+	desiredPackages, excluded, err := buildDesiredPackagesFromDefs(defs, machine, appCtx.Pacman)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve desired packages: %w", err)
+	}
 
 	previouslyManaged, err := getPreviouslyManagedPackages(ctx, appCtx.QueryClient, hostname)
 	if err != nil {
-		return fmt.Errorf("failed to get previously managed packages: %w", err)
+		return nil, fmt.Errorf("failed to get previously managed packages: %w", err)
 	}
 
 	diff := calculateDiffWithDatabase(desiredPackages, installedPackages, previouslyManaged, *appCtx.Config)
+	diff.Excluded = excluded
+
+	return &SyncState{
+		Hostname:    hostname,
+		Definitions: hostDefs,
+		Installed:   installedPackages,
+		Desired:     desiredPackages,
+		Diff:        diff,
+	}, nil
+}
 
-	printPackageChanges(appCtx, diff, opts.Strict)
-
-	if opts.DryRun {
-		fmt.Println("Dry run mode — no changes made")
-		return nil
+// executeSync applies the diff after confirmation, records the run in the
+// history and remembers the desired packages as managed by ditto
+func executeSync(ctx context.Context, appCtx *AppContext, state *SyncState, opts SyncOptions, started time.Time) (*ApplyResult, error) {
+	result, applyErr := applyPackageChanges(state.Diff, opts, appCtx.Pacman)
+	if len(result.Changes) > 0 && !result.Aborted {
+		after, err := appCtx.Pacman.ListInstalled()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: failed to list installed packages, the history won't have their new versions: %v\n", err)
+		}
+		result.fillVersions(state.Installed, after)
+	}
+	info := TransactionInfo{
+		Started:     started,
+		Host:        state.Hostname,
+		Flags:       opts.Flags(),
+		InstallArgs: opts.InstallArgs,
+		RemoveArgs:  opts.RemoveArgs,
+	}
+	if err := recordTransaction(ctx, appCtx.QueryClient, info, result, applyErr); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+	}
+	if applyErr != nil || result.Aborted {
+		return result, applyErr
 	}
 
-	if err := applyPackageChanges(diff, opts, appCtx.Pacman); err != nil {
-		return err
+	// Declined removals stay managed, so the next sync offers them again
+	managed := state.Desired
+	for _, change := range result.Changes {
+		if change.Action == ActionRemoveUnmanaged && change.Status == StatusSkipped &&
+			!slices.ContainsFunc(state.Desired, func(pkg DesiredPackage) bool { return pkg.Name == change.Package }) {
+			managed = append(managed, DesiredPackage{Name: change.Package, Scopes: []string{state.Hostname}})
+		}
 	}
 
-	return updateManagedPackages(ctx, queries, desiredPackages, hostname)
+	return result, updateManagedPackages(ctx, appCtx.QueryClient, managed, state.Hostname)
 }
 
-func buildDesiredPackagesFromDefs(defs []Definition) []string {
-	hostname, err := os.Hostname()
-	if err != nil {
-		log.Fatalf("cannot get current hostname: %v", err)
+// definitionsFor returns the definitions that apply to the given machine
+func definitionsFor(defs []Definition, machine Machine) []Definition {
+	var applicable []Definition
+	for _, def := range defs {
+		if def.AppliesTo(machine) {
+			applicable = append(applicable, def)
+		}
+	}
+	return applicable
+}
+
+// buildDesiredPackagesFromDefs returns the packages the definitions applying to
+// the machine request, skipping the [if] blocks its facts don't satisfy, and
+// the "!pkg" lines that excluded packages from them. When the facts are
+// unknown, the sources of entries in [if] blocks tell their conditions.
+func buildDesiredPackagesFromDefs(defs []Definition, machine Machine, groups GroupResolver) ([]DesiredPackage, map[string]PackageSource, error) {
+	unique := make(map[string]DesiredPackage)
+	members := make(map[string][]string)
+	// precedence is the highest precedence of the declarations of each package
+	precedence := make(map[string]int)
+
+	add := func(pkg DesiredPackage, def Definition, source PackageSource) {
+		scope := def.ManagedScope(machine.Hostname)
+		if p, ok := precedence[pkg.Name]; !ok || def.Precedence() > p {
+			precedence[pkg.Name] = def.Precedence()
+		}
+
+		existing, ok := unique[pkg.Name]
+		if ok {
+			// A direct declaration wins over group membership
+			if pkg.Group != "" || existing.Group == "" {
+				pkg.Group = existing.Group
+			}
+			pkg.Scopes = existing.Scopes
+			pkg.Sources = existing.Sources
+		}
+		if !slices.Contains(pkg.Scopes, scope) {
+			pkg.Scopes = append(pkg.Scopes, scope)
+		}
+		pkg.Sources = append(pkg.Sources, source)
+		unique[pkg.Name] = pkg
+	}
+
+	type exclusion struct {
+		source     PackageSource
+		precedence int
+	}
+	exclusions := make(map[string]exclusion)
+
+	// source returns where an entry in effect on the machine is declared. When
+	// the facts of the machine are unknown, entries of [if] blocks are kept
+	// with their conditions, unevaluated.
+	source := func(def Definition, line int, comment string, when Conditions) (PackageSource, bool) {
+		src := def.Source(line, comment)
+		if machine.Facts == nil {
+			src.When = when.String()
+			return src, true
+		}
+		return src, when.Holds(machine.Facts)
 	}
 
-	unique := make(map[string]struct{})
 	for _, def := range defs {
-		if def.Host == nil || *def.Host == hostname {
-			for _, pkg := range def.Packages {
-				unique[pkg] = struct{}{}
+		if !def.AppliesTo(machine) {
+			continue
+		}
+
+		for _, pkg := range def.Packages {
+			if src, ok := source(def, pkg.Line, pkg.Comment, pkg.When); ok {
+				add(DesiredPackage{Name: pkg.Name}, def, src)
+			}
+		}
+
+		for _, pkg := range def.Excludes {
+			src, ok := source(def, pkg.Line, pkg.Comment, pkg.When)
+			if !ok {
+				continue
+			}
+			if ex, ok := exclusions[pkg.Name]; !ok || def.Precedence() > ex.precedence {
+				exclusions[pkg.Name] = exclusion{src, def.Precedence()}
+			}
+		}
+
+		for _, group := range def.Groups {
+			src, ok := source(def, group.Line, group.Comment, group.When)
+			if !ok {
+				continue
+			}
+			if _, ok := members[group.Name]; !ok {
+				m, err := groups.GroupMembers(group.Name)
+				if err != nil {
+					return nil, nil, err
+				}
+				members[group.Name] = m
+			}
+
+			for _, pkg := range members[group.Name] {
+				if !slices.Contains(group.Exclude, pkg) {
+					add(DesiredPackage{Name: pkg, Group: group.Name}, def, src)
+				}
 			}
 		}
 	}
 
-	packages := make([]string, 0, len(unique))
-	for pkg := range unique {
+	// An exclusion drops the package unless a declaration has a higher
+	// precedence. Unevaluated ones are reported without dropping anything.
+	excluded := make(map[string]PackageSource)
+	for name, ex := range exclusions {
+		if p, ok := precedence[name]; ok && p > ex.precedence {
+			continue
+		}
+		if !ex.source.Conditional() {
+			delete(unique, name)
+		}
+		excluded[name] = ex.source
+	}
+
+	packages := make([]DesiredPackage, 0, len(unique))
+	for _, pkg := range unique {
 		packages = append(packages, pkg)
 	}
-	sort.Strings(packages)
-	return packages
+	sort.Slice(packages, func(i, j int) bool {
+		return packages[i].Name < packages[j].Name
+	})
+	return packages, excluded, nil
 }
 
+// getPreviouslyManagedPackages returns the packages the last sync of the host
+// recorded. A host without records yet gets the unclaimed records of a
+// database that predates per-host records instead.
 func getPreviouslyManagedPackages(ctx context.Context, queries *database.Queries, hostname string) ([]string, error) {
-	hostPackages, err := queries.GetPackagesByHost(ctx, database.GetPackagesByHostParams{
-		Host: sql.NullString{String: hostname},
-	})
+	hostPackages, err := queries.GetPackagesByHost(ctx, hostname)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get host packages: %w", err)
 	}
 
-	globalPackages, err := queries.GetPackagesByHost(ctx, database.GetPackagesByHostParams{})
-	if err != nil {
-		return nil, fmt.Errorf("failed to get global packages: %w", err)
+	if len(hostPackages) == 0 {
+		hostPackages, err = queries.GetPackagesByHost(ctx, unclaimedHost)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get unclaimed packages: %w", err)
+		}
 	}
 
 	packageSet := make(map[string]struct{})
 	for _, pkg := range hostPackages {
 		packageSet[pkg.Name] = struct{}{}
 	}
-	for _, pkg := range globalPackages {
-		packageSet[pkg.Name] = struct{}{}
-	}
 
 	packages := make([]string, 0, len(packageSet))
 	for pkg := range packageSet {
@@ -133,59 +417,121 @@ func getPreviouslyManagedPackages(ctx context.Context, queries *database.Queries
 	return packages, nil
 }
 
-func calculateDiffWithDatabase(desired, installed, previouslyManaged []string, cfg Config) PackageDiff {
+func calculateDiffWithDatabase(desired []DesiredPackage, installed []InstalledPackage, previouslyManaged []string, cfg Config) PackageDiff {
+	desired = resolveProviders(desired, installed)
+
 	installedSet := make(map[string]bool, len(installed))
+	explicitSet := make(map[string]bool, len(installed))
 	for _, pkg := range installed {
-		installedSet[pkg] = true
+		installedSet[pkg.Name] = true
+		if pkg.Reason == ReasonExplicit {
+			explicitSet[pkg.Name] = true
+		}
 	}
 
 	desiredSet := make(map[string]bool, len(desired))
+	desiredByName := make(map[string]DesiredPackage, len(desired))
 	for _, pkg := range desired {
-		desiredSet[pkg] = true
-	}
-
-	previouslyManagedSet := make(map[string]bool, len(previouslyManaged))
-	for _, pkg := range previouslyManaged {
-		previouslyManagedSet[pkg] = true
+		desiredSet[pkg.Name] = true
+		desiredByName[pkg.Name] = pkg
 	}
 
-	var toAdd, toRemove, toRemoveFromDitto []string
+	var toAdd, toRemove, toRemoveFromDitto, toMarkExplicit []string
 
 	for _, pkg := range desired {
-		if !installedSet[pkg] {
-			toAdd = append(toAdd, pkg)
-		}
-	}
-
-	for _, pkg := range installed {
-		if !desiredSet[pkg] && !slices.Contains(cfg.UninstallIgnore, pkg) {
-			toRemove = append(toRemove, pkg)
+		if !installedSet[pkg.Name] {
+			toAdd = append(toAdd, pkg.Name)
+		} else if !explicitSet[pkg.Name] {
+			toMarkExplicit = append(toMarkExplicit, pkg.Name)
 		}
 	}
 
+	removedFromDitto := make(map[string]bool, len(previouslyManaged))
 	for _, pkg := range previouslyManaged {
 		if !desiredSet[pkg] && installedSet[pkg] && !slices.Contains(cfg.UninstallIgnore, pkg) {
 			toRemoveFromDitto = append(toRemoveFromDitto, pkg)
+			removedFromDitto[pkg] = true
+		}
+	}
+
+	for _, pkg := range installed {
+		if pkg.Reason != ReasonExplicit || desiredSet[pkg.Name] || removedFromDitto[pkg.Name] {
+			continue
+		}
+		if !slices.Contains(cfg.UninstallIgnore, pkg.Name) {
+			toRemove = append(toRemove, pkg.Name)
 		}
 	}
 
 	sort.Strings(toAdd)
 	sort.Strings(toRemove)
 	sort.Strings(toRemoveFromDitto)
+	sort.Strings(toMarkExplicit)
+
+	return PackageDiff{
+		ToAdd:             toAdd,
+		ToRemove:          toRemove,
+		ToRemoveFromDitto: toRemoveFromDitto,
+		ToMarkExplicit:    toMarkExplicit,
+		Desired:           desiredByName,
+	}
+}
+
+// resolveProviders swaps desired names that are not installed as such for the
+// installed packages that provide or replace them, so virtual names like "sh"
+// are satisfied and their providers count as desired.
+func resolveProviders(desired []DesiredPackage, installed []InstalledPackage) []DesiredPackage {
+	installedSet := make(map[string]bool, len(installed))
+	providers := make(map[string][]string)
+	for _, pkg := range installed {
+		installedSet[pkg.Name] = true
+		for _, name := range slices.Concat(pkg.Provides, pkg.Replaces) {
+			if name != pkg.Name {
+				providers[name] = append(providers[name], pkg.Name)
+			}
+		}
+	}
+
+	resolved := make(map[string]DesiredPackage, len(desired))
+	for _, pkg := range desired {
+		if installedSet[pkg.Name] || len(providers[pkg.Name]) == 0 {
+			resolved[pkg.Name] = pkg
+			continue
+		}
+		for _, provider := range providers[pkg.Name] {
+			// A package declared by its own name wins over a provider match
+			if _, ok := resolved[provider]; !ok {
+				resolved[provider] = DesiredPackage{
+					Name:     provider,
+					Group:    pkg.Group,
+					Scopes:   pkg.Scopes,
+					Provides: pkg.Name,
+					Sources:  pkg.Sources,
+				}
+			}
+		}
+	}
 
-	return PackageDiff{toAdd, toRemove, toRemoveFromDitto}
+	packages := make([]DesiredPackage, 0, len(resolved))
+	for _, pkg := range resolved {
+		packages = append(packages, pkg)
+	}
+	sort.Slice(packages, func(i, j int) bool {
+		return packages[i].Name < packages[j].Name
+	})
+	return packages
 }
 
 func printPackageChanges(appCtx *AppContext, diff PackageDiff, strict bool) {
-	hasChanges := len(diff.ToAdd) > 0 ||
-		(strict && len(diff.ToRemove) > 0) ||
-		len(diff.ToRemoveFromDitto) > 0
-
-	if !hasChanges {
+	if !diff.HasChanges(strict) {
 		return
 	}
 
-	t := buildDiffTable(diff, strict)
+	printChangeRows(appCtx, diffRows(diff, strict))
+}
+
+func printChangeRows(appCtx *AppContext, rows []ChangeRow) {
+	t := buildChangesTable(rows)
 	var out bytes.Buffer
 	out.WriteString("\n")
 	out.WriteString(t.String())
@@ -193,61 +539,175 @@ func printPackageChanges(appCtx *AppContext, diff PackageDiff, strict bool) {
 	displayWithOptionalPager(appCtx, &out)
 }
 
-func applyPackageChanges(diff PackageDiff, opts SyncOptions, pm PackageManager) error {
-	hasChanges := len(diff.ToAdd) > 0 ||
-		(opts.Strict && len(diff.ToRemove) > 0) ||
-		len(diff.ToRemoveFromDitto) > 0
-
-	if !hasChanges {
+func applyPackageChanges(diff PackageDiff, opts SyncOptions, pm PackageManager) (*ApplyResult, error) {
+	result := &ApplyResult{}
+	if !diff.HasChanges(opts.Strict) {
 		fmt.Println("Nothing to apply.")
-		return nil
+		return result, nil
 	}
 
-	fmt.Print("Proceed with applying changes? [y/N]: ")
-	var input string
-	_, err := fmt.Scanln(&input)
-	if err != nil || strings.ToLower(strings.TrimSpace(input)) != "y" {
+	result.Changes = plannedChanges(diff, opts.Strict)
+	defer result.skipRemaining()
+
+	// Declined changes stay planned and end up skipped
+	diff, ok, err := approveChanges(diff, opts)
+	if err != nil {
+		return result, err
+	}
+	if !ok {
 		fmt.Println("Aborted.")
-		return nil
+		result.Aborted = true
+		return result, nil
 	}
 
 	if len(diff.ToAdd) > 0 {
-		if err := pm.Install(diff.ToAdd, opts.InstallArgs...); err != nil {
-			return fmt.Errorf("install failed: %w", err)
+		err := pm.Install(diff.ToAdd, opts.InstallArgs...)
+		result.settle(ActionInstall, diff.ToAdd, err)
+		if err != nil {
+			return result, fmt.Errorf("install failed: %w", err)
+		}
+	}
+
+	if len(diff.ToMarkExplicit) > 0 && opts.Strict {
+		err := pm.MarkExplicit(diff.ToMarkExplicit)
+		result.settle(ActionMarkExplicit, diff.ToMarkExplicit, err)
+		if err != nil {
+			return result, fmt.Errorf("marking packages as explicit failed: %w", err)
 		}
 	}
 
 	if len(diff.ToRemove) > 0 && opts.Strict {
-		if err := pm.Remove(diff.ToRemove, opts.RemoveArgs...); err != nil {
-			return fmt.Errorf("remove failed: %w", err)
+		if err := demoteAndRemoveOrphans(diff.ToRemove, opts, pm, result); err != nil {
+			return result, err
 		}
 	}
 
 	if len(diff.ToRemoveFromDitto) > 0 {
 		fmt.Printf("Removing packages no longer managed by ditto: %v\n", diff.ToRemoveFromDitto)
-		if err := pm.Remove(diff.ToRemoveFromDitto, opts.RemoveArgs...); err != nil {
-			return fmt.Errorf("ditto package removal failed: %w", err)
+		err := pm.Remove(diff.ToRemoveFromDitto, opts.RemoveArgs...)
+		result.settle(ActionRemoveUnmanaged, diff.ToRemoveFromDitto, err)
+		if err != nil {
+			return result, fmt.Errorf("ditto package removal failed: %w", err)
 		}
 	}
 
 	fmt.Println("Changes applied.")
+	return result, nil
+}
+
+// approveChanges asks which changes to apply and narrows the diff to them.
+// ok is false when nothing was approved.
+func approveChanges(diff PackageDiff, opts SyncOptions) (approved PackageDiff, ok bool, err error) {
+	if opts.Selected != nil {
+		return *opts.Selected, opts.Selected.HasChanges(opts.Strict), nil
+	}
+	if opts.Yes {
+		return diff, true, nil
+	}
+	if !opts.ConfirmEach {
+		ok, err := confirm("Proceed with applying changes?")
+		return diff, ok, err
+	}
+
+	pick := func(question string, pkgs []string) []string {
+		var picked []string
+		for _, pkg := range pkgs {
+			if err != nil {
+				return nil
+			}
+			var yes bool
+			if yes, err = confirm(fmt.Sprintf(question, pkg)); yes {
+				picked = append(picked, pkg)
+			}
+		}
+		return picked
+	}
+
+	approved = diff
+	approved.ToAdd = pick("Install %s?", diff.ToAdd)
+	if opts.Strict {
+		approved.ToMarkExplicit = pick("Mark %s as explicitly installed?", diff.ToMarkExplicit)
+		approved.ToRemove = pick("Demote %s to a dependency, removing it if orphaned?", diff.ToRemove)
+	}
+	approved.ToRemoveFromDitto = pick("Remove %s, no longer managed by ditto?", diff.ToRemoveFromDitto)
+	if err != nil {
+		return diff, false, err
+	}
+
+	return approved, approved.HasChanges(opts.Strict), nil
+}
+
+// confirm asks a yes/no question on stdin, defaulting to no. It fails when
+// stdin is not a terminal, since nobody could answer.
+func confirm(prompt string) (bool, error) {
+	if !term.IsTerminal(os.Stdin.Fd()) {
+		return false, errors.New("cannot ask for confirmation: stdin is not a terminal, use --yes to run unattended")
+	}
+
+	fmt.Printf("%s [y/N]: ", prompt)
+	var input string
+	_, err := fmt.Scanln(&input)
+	return err == nil && strings.ToLower(strings.TrimSpace(input)) == "y", nil
+}
+
+// demoteAndRemoveOrphans marks unlisted packages as dependencies, then removes
+// the ones nothing else depends on. Packages still required stay installed as deps.
+func demoteAndRemoveOrphans(pkgs []string, opts SyncOptions, pm PackageManager, result *ApplyResult) error {
+	err := pm.MarkAsDeps(pkgs)
+	result.settle(ActionDemote, pkgs, err)
+	if err != nil {
+		return fmt.Errorf("demoting packages failed: %w", err)
+	}
+
+	orphans, err := pm.ListOrphans()
+	if err != nil {
+		return err
+	}
+
+	demoted := make(map[string]bool, len(pkgs))
+	for _, pkg := range pkgs {
+		demoted[pkg] = true
+	}
+
+	var toRemove []string
+	for _, pkg := range orphans {
+		if demoted[pkg] {
+			toRemove = append(toRemove, pkg)
+		}
+	}
+
+	if len(toRemove) == 0 {
+		return nil
+	}
+
+	err = pm.Remove(toRemove, opts.RemoveArgs...)
+	result.record(ActionRemove, toRemove, err)
+	if err != nil {
+		return fmt.Errorf("remove failed: %w", err)
+	}
+
 	return nil
 }
 
-func updateManagedPackages(ctx context.Context, queries *database.Queries, desiredPackages []string, hostname string) error {
-	if err := queries.DeletePackagesByHost(ctx, database.DeletePackagesByHostParams{
-		Host: sql.NullString{String: hostname},
-	}); err != nil {
-		return fmt.Errorf("failed to clear existing packages for host: %w", err)
+// updateManagedPackages records the desired packages as managed by the host,
+// with the scope of the definitions that declared them. Only the records of
+// this host are replaced, other hosts sharing the database keep theirs.
+func updateManagedPackages(ctx context.Context, queries *database.Queries, desiredPackages []DesiredPackage, hostname string) error {
+	// Unclaimed records are left for the hosts that have not synced yet
+	if err := queries.DeletePackagesByHost(ctx, hostname); err != nil {
+		return fmt.Errorf("failed to clear existing packages: %w", err)
 	}
 
 	for _, pkg := range desiredPackages {
-		_, err := queries.CreatePackage(ctx, database.CreatePackageParams{
-			Name: pkg,
-			Host: sql.NullString{String: hostname},
-		})
-		if err != nil {
-			return fmt.Errorf("failed to insert package %s: %w", pkg, err)
+		for _, scope := range pkg.Scopes {
+			_, err := queries.CreatePackage(ctx, database.CreatePackageParams{
+				Host:  hostname,
+				Scope: scope,
+				Name:  pkg.Name,
+			})
+			if err != nil {
+				return fmt.Errorf("failed to insert package %s: %w", pkg.Name, err)
+			}
 		}
 	}
 
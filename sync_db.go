@@ -0,0 +1,181 @@
+package main
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// SyncPackage is a package available from a configured repository
+type SyncPackage struct {
+	Name        string
+	Version     string
+	Repo        string
+	Description string
+	Groups      []string
+	Provides    []string
+	Replaces    []string
+	Depends     []string
+}
+
+// SyncDB reads the repository databases (<dbpath>/sync/<repo>.db) that pacman
+// downloads on -Sy, without spawning pacman
+type SyncDB struct {
+	root string
+	pkgs []SyncPackage
+	// groups maps each group to its members, built along with pkgs
+	groups map[string][]string
+	// skipped are the repositories whose database could not be read
+	skipped []string
+}
+
+func NewSyncDB(root string) *SyncDB {
+	return &SyncDB{root: root}
+}
+
+// Packages returns every package of every repository database, sorted by name.
+// The databases are only read once, and the ones that can't be read are
+// skipped with a warning.
+func (db *SyncDB) Packages() ([]SyncPackage, error) {
+	if db.pkgs != nil {
+		return db.pkgs, nil
+	}
+
+	files, err := filepath.Glob(filepath.Join(db.root, "sync", "*.db"))
+	if err != nil {
+		return nil, err
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("no sync databases found in %s, run pacman -Sy first", filepath.Join(db.root, "sync"))
+	}
+
+	pkgs := []SyncPackage{}
+	var errs []error
+	for _, file := range files {
+		repo := strings.TrimSuffix(filepath.Base(file), ".db")
+		repoPkgs, err := readSyncDBFile(file, repo)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("failed to read %s: %w", file, err))
+			db.skipped = append(db.skipped, repo)
+			continue
+		}
+		pkgs = append(pkgs, repoPkgs...)
+	}
+	if len(errs) == len(files) {
+		return nil, errors.Join(errs...)
+	}
+	for _, err := range errs {
+		fmt.Fprintf(os.Stderr, "Warning: %v, its packages are ignored\n", err)
+	}
+
+	sort.SliceStable(pkgs, func(i, j int) bool {
+		return pkgs[i].Name < pkgs[j].Name
+	})
+
+	// Packages are sorted, a name found in several repositories is listed once
+	groups := make(map[string][]string)
+	for _, pkg := range pkgs {
+		for _, group := range pkg.Groups {
+			members := groups[group]
+			if len(members) == 0 || members[len(members)-1] != pkg.Name {
+				groups[group] = append(members, pkg.Name)
+			}
+		}
+	}
+	db.pkgs = pkgs
+	db.groups = groups
+	return pkgs, nil
+}
+
+// Skipped returns the repositories Packages could not read, whose packages
+// are missing from its result
+func (db *SyncDB) Skipped() []string {
+	return db.skipped
+}
+
+// GroupMembers returns the packages of a group across all repositories
+func (db *SyncDB) GroupMembers(group string) ([]string, error) {
+	if _, err := db.Packages(); err != nil {
+		return nil, err
+	}
+	return db.groups[group], nil
+}
+
+// readSyncDBFile reads a repository database, a tar archive (usually gzipped)
+// holding one "<pkg>-<ver>/desc" entry per package
+func readSyncDBFile(file, repo string) ([]SyncPackage, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	r, err := decompress(bufio.NewReader(f))
+	if err != nil {
+		return nil, err
+	}
+
+	var pkgs []SyncPackage
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if hdr.Typeflag != tar.TypeReg || path.Base(hdr.Name) != "desc" {
+			continue
+		}
+
+		fields, err := parseDesc(tr)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse %s: %w", hdr.Name, err)
+		}
+
+		pkgs = append(pkgs, SyncPackage{
+			Name:        firstValue(fields["NAME"]),
+			Version:     firstValue(fields["VERSION"]),
+			Repo:        repo,
+			Description: firstValue(fields["DESC"]),
+			Groups:      fields["GROUPS"],
+			Provides:    depNames(fields["PROVIDES"]),
+			Replaces:    depNames(fields["REPLACES"]),
+			Depends:     depNames(fields["DEPENDS"]),
+		})
+	}
+
+	return pkgs, nil
+}
+
+var (
+	gzipMagic = []byte{0x1f, 0x8b}
+	zstdMagic = []byte{0x28, 0xb5, 0x2f, 0xfd}
+)
+
+// decompress detects the compression of a database from its magic bytes
+func decompress(r *bufio.Reader) (io.Reader, error) {
+	magic, err := r.Peek(4)
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+
+	switch {
+	case bytes.HasPrefix(magic, gzipMagic):
+		return gzip.NewReader(r)
+	case bytes.HasPrefix(magic, zstdMagic):
+		return nil, fmt.Errorf("zstd compressed databases are not supported")
+	default:
+		return r, nil
+	}
+}
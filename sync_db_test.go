@@ -0,0 +1,160 @@
+package main
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// writeSyncDB archives the desc files of testdata/syncdb/<repo> into
+// <root>/sync/<repo>.db the way repo-add does, gzipped unless plain is set
+func writeSyncDB(t *testing.T, root, repo string, plain bool) {
+	t.Helper()
+
+	if err := os.MkdirAll(filepath.Join(root, "sync"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	f, err := os.Create(filepath.Join(root, "sync", repo+".db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	var w io.Writer = f
+	if !plain {
+		gz := gzip.NewWriter(f)
+		defer gz.Close()
+		w = gz
+	}
+	tw := tar.NewWriter(w)
+	defer tw.Close()
+
+	src := filepath.Join("testdata", "syncdb", repo)
+	entries, err := os.ReadDir(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, entry := range entries {
+		if err := tw.WriteHeader(&tar.Header{Name: entry.Name() + "/", Typeflag: tar.TypeDir, Mode: 0o755}); err != nil {
+			t.Fatal(err)
+		}
+		desc, err := os.ReadFile(filepath.Join(src, entry.Name(), "desc"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		hdr := &tar.Header{Name: entry.Name() + "/desc", Typeflag: tar.TypeReg, Mode: 0o644, Size: int64(len(desc))}
+		if err := tw.WriteHeader(hdr); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write(desc); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestReadSyncDBFile(t *testing.T) {
+	for _, plain := range []bool{false, true} {
+		root := t.TempDir()
+		writeSyncDB(t, root, "core", plain)
+
+		pkgs, err := readSyncDBFile(filepath.Join(root, "sync", "core.db"), "core")
+		if err != nil {
+			t.Fatalf("plain=%v: %v", plain, err)
+		}
+
+		want := []SyncPackage{
+			{
+				Name:        "bash",
+				Version:     "5.2.026-2",
+				Repo:        "core",
+				Description: "The GNU Bourne Again shell",
+				Provides:    []string{"sh"},
+				Depends:     []string{"readline", "glibc"},
+			},
+			{
+				Name:        "pacman",
+				Version:     "6.1.0-3",
+				Repo:        "core",
+				Description: "A library-based package manager with dependency support",
+				Groups:      []string{"base-devel"},
+				Depends:     []string{"bash", "curl"},
+			},
+		}
+		if !reflect.DeepEqual(pkgs, want) {
+			t.Errorf("plain=%v: readSyncDBFile() = %+v, want %+v", plain, pkgs, want)
+		}
+	}
+}
+
+func TestSyncDBPackages(t *testing.T) {
+	root := t.TempDir()
+	writeSyncDB(t, root, "core", false)
+	writeSyncDB(t, root, "extra", false)
+
+	db := NewSyncDB(root)
+	pkgs, err := db.Packages()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var names []string
+	for _, pkg := range pkgs {
+		names = append(names, pkg.Repo+"/"+pkg.Name)
+	}
+	want := []string{"core/bash", "extra/gnome-shell", "extra/neovim", "core/pacman"}
+	if !reflect.DeepEqual(names, want) {
+		t.Errorf("Packages() = %v, want %v", names, want)
+	}
+
+	members, err := db.GroupMembers("gnome")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(members, []string{"gnome-shell"}) {
+		t.Errorf("GroupMembers(gnome) = %v, want [gnome-shell]", members)
+	}
+	if members, _ := db.GroupMembers("base-devel"); !reflect.DeepEqual(members, []string{"pacman"}) {
+		t.Errorf("GroupMembers(base-devel) = %v, want [pacman]", members)
+	}
+	if members, _ := db.GroupMembers("kde"); members != nil {
+		t.Errorf("GroupMembers(kde) = %v, want no member", members)
+	}
+}
+
+func TestSyncDBPackagesSkipsUnreadableRepos(t *testing.T) {
+	root := t.TempDir()
+	writeSyncDB(t, root, "extra", false)
+	zstd := append([]byte{}, zstdMagic...)
+	if err := os.WriteFile(filepath.Join(root, "sync", "core.db"), append(zstd, "data"...), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	db := NewSyncDB(root)
+	pkgs, err := db.Packages()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pkgs) != 2 || pkgs[0].Repo != "extra" || pkgs[1].Repo != "extra" {
+		t.Errorf("Packages() = %+v, want the packages of extra only", pkgs)
+	}
+	if !reflect.DeepEqual(db.Skipped(), []string{"core"}) {
+		t.Errorf("Skipped() = %v, want [core]", db.Skipped())
+	}
+
+	if err := os.Remove(filepath.Join(root, "sync", "extra.db")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewSyncDB(root).Packages(); err == nil {
+		t.Error("Packages() succeeded without any readable database")
+	}
+}
+
+func TestSyncDBPackagesWithoutDatabases(t *testing.T) {
+	if _, err := NewSyncDB(t.TempDir()).Packages(); err == nil {
+		t.Error("Packages() succeeded without databases")
+	}
+}
@@ -0,0 +1,307 @@
+package main
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/ony-boom/ditto/database"
+)
+
+// fixtureInstalled returns the packages of testdata/pacman/local: bash (a
+// dependency providing sh), groff (a dependency), man-db and zsh (explicit)
+func fixtureInstalled(t *testing.T) []InstalledPackage {
+	t.Helper()
+	pkgs, err := NewLocalDB("testdata/pacman").Packages()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pkgs
+}
+
+func desiredNames(pkgs []DesiredPackage) []string {
+	var names []string
+	for _, pkg := range pkgs {
+		names = append(names, pkg.Name)
+	}
+	return names
+}
+
+func TestCalculateDiffWithDatabase(t *testing.T) {
+	installed := fixtureInstalled(t)
+	desired := []DesiredPackage{
+		{Name: "sh", Scopes: []string{globalScope}, Sources: []PackageSource{{File: "base.pkgs", Line: 1}}},
+		{Name: "groff", Scopes: []string{"laptop"}},
+		{Name: "neovim", Scopes: []string{globalScope}},
+	}
+	previouslyManaged := []string{"man-db", "vim"}
+
+	diff := calculateDiffWithDatabase(desired, installed, previouslyManaged, Config{})
+
+	if want := []string{"neovim"}; !reflect.DeepEqual(diff.ToAdd, want) {
+		t.Errorf("ToAdd = %v, want %v", diff.ToAdd, want)
+	}
+	// sh is satisfied by bash, which is only installed as a dependency
+	if want := []string{"bash", "groff"}; !reflect.DeepEqual(diff.ToMarkExplicit, want) {
+		t.Errorf("ToMarkExplicit = %v, want %v", diff.ToMarkExplicit, want)
+	}
+	// vim was managed but is not installed anymore
+	if want := []string{"man-db"}; !reflect.DeepEqual(diff.ToRemoveFromDitto, want) {
+		t.Errorf("ToRemoveFromDitto = %v, want %v", diff.ToRemoveFromDitto, want)
+	}
+	if want := []string{"zsh"}; !reflect.DeepEqual(diff.ToRemove, want) {
+		t.Errorf("ToRemove = %v, want %v", diff.ToRemove, want)
+	}
+
+	bash, ok := diff.Desired["bash"]
+	if !ok || bash.Provides != "sh" || !reflect.DeepEqual(bash.Sources, desired[0].Sources) {
+		t.Errorf("Desired[bash] = %+v, want the provider of sh with its sources", bash)
+	}
+	if _, ok := diff.Desired["sh"]; ok {
+		t.Error("Desired has sh, want it replaced by its provider")
+	}
+}
+
+func TestCalculateDiffWithDatabaseUninstallIgnore(t *testing.T) {
+	installed := fixtureInstalled(t)
+	cfg := Config{UninstallIgnore: []string{"man-db", "zsh"}}
+
+	diff := calculateDiffWithDatabase(nil, installed, []string{"man-db"}, cfg)
+
+	if diff.ToRemove != nil || diff.ToRemoveFromDitto != nil {
+		t.Errorf("ToRemove = %v, ToRemoveFromDitto = %v, want nothing to remove", diff.ToRemove, diff.ToRemoveFromDitto)
+	}
+	if diff.HasChanges(true) {
+		t.Error("HasChanges(true) = true, want false")
+	}
+}
+
+func TestResolveProviders(t *testing.T) {
+	installed := []InstalledPackage{
+		{Name: "bash", Provides: []string{"sh"}},
+		{Name: "dash", Provides: []string{"sh"}},
+		{Name: "jre-openjdk", Provides: []string{"java-runtime"}},
+		{Name: "neovim", Replaces: []string{"neovim-nightly"}},
+	}
+
+	tests := []struct {
+		name    string
+		desired []DesiredPackage
+		want    []DesiredPackage
+	}{
+		{
+			name:    "installed names are kept",
+			desired: []DesiredPackage{{Name: "bash"}, {Name: "ripgrep"}},
+			want:    []DesiredPackage{{Name: "bash"}, {Name: "ripgrep"}},
+		},
+		{
+			name:    "virtual names are replaced by every provider",
+			desired: []DesiredPackage{{Name: "sh", Group: "base", Scopes: []string{"laptop"}}},
+			want: []DesiredPackage{
+				{Name: "bash", Group: "base", Scopes: []string{"laptop"}, Provides: "sh"},
+				{Name: "dash", Group: "base", Scopes: []string{"laptop"}, Provides: "sh"},
+			},
+		},
+		{
+			name:    "replaced packages resolve to their replacement",
+			desired: []DesiredPackage{{Name: "neovim-nightly"}, {Name: "java-runtime"}},
+			want: []DesiredPackage{
+				{Name: "jre-openjdk", Provides: "java-runtime"},
+				{Name: "neovim", Provides: "neovim-nightly"},
+			},
+		},
+		{
+			name: "a package declared by name wins over a provider match",
+			desired: []DesiredPackage{
+				{Name: "bash", Sources: []PackageSource{{File: "base.pkgs", Line: 1}}},
+				{Name: "sh", Sources: []PackageSource{{File: "base.pkgs", Line: 2}}},
+			},
+			want: []DesiredPackage{
+				{Name: "bash", Sources: []PackageSource{{File: "base.pkgs", Line: 1}}},
+				{Name: "dash", Provides: "sh", Sources: []PackageSource{{File: "base.pkgs", Line: 2}}},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := resolveProviders(tt.desired, installed)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("resolveProviders() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestResolveProvidersWithFixture(t *testing.T) {
+	got := resolveProviders([]DesiredPackage{{Name: "sh"}, {Name: "zsh"}}, fixtureInstalled(t))
+	if want := []string{"bash", "zsh"}; !reflect.DeepEqual(desiredNames(got), want) {
+		t.Errorf("resolveProviders() = %v, want %v", desiredNames(got), want)
+	}
+}
+
+func TestBuildDesiredPackagesFromDefsGroups(t *testing.T) {
+	tests := []struct {
+		name string
+		defs []Definition
+		want []DesiredPackage
+	}{
+		{
+			name: "a declaration by name wins over the group",
+			defs: []Definition{
+				{File: "base.pkgs", Packages: []PackageEntry{{Name: "vim", Line: 1}}},
+				{File: "editors.pkgs", Groups: []GroupEntry{{Name: "editors", Line: 1}}},
+			},
+			want: []DesiredPackage{
+				{Name: "nano", Group: "editors", Scopes: []string{globalScope}, Sources: []PackageSource{{File: "editors.pkgs", Line: 1}}},
+				{Name: "vim", Scopes: []string{globalScope}, Sources: []PackageSource{{File: "base.pkgs", Line: 1}, {File: "editors.pkgs", Line: 1}}},
+			},
+		},
+		{
+			name: "excluded members are dropped",
+			defs: []Definition{{File: "editors.pkgs", Groups: []GroupEntry{{Name: "editors", Exclude: []string{"nano"}, Line: 1}}}},
+			want: []DesiredPackage{
+				{Name: "vim", Group: "editors", Scopes: []string{globalScope}, Sources: []PackageSource{{File: "editors.pkgs", Line: 1}}},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, _, err := buildDesiredPackagesFromDefs(tt.defs, Machine{Hostname: "laptop"}, editorsGroup{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("buildDesiredPackagesFromDefs() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestManagedPackagesPerHost(t *testing.T) {
+	ctx := context.Background()
+	queries := newTestAppContext(t, "").QueryClient
+
+	// Records migrated from a database that knew no host
+	for _, name := range []string{"git", "vim"} {
+		if _, err := queries.CreatePackage(ctx, database.CreatePackageParams{Host: unclaimedHost, Scope: globalScope, Name: name}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	previous := func(host string) []string {
+		t.Helper()
+		pkgs, err := getPreviouslyManagedPackages(ctx, queries, host)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return pkgs
+	}
+
+	if got, want := previous("laptop"), []string{"git", "vim"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("laptop before its first sync = %v, want the unclaimed records %v", got, want)
+	}
+
+	desired := []DesiredPackage{
+		{Name: "git", Scopes: []string{globalScope}},
+		{Name: "tlp", Scopes: []string{"laptop"}},
+	}
+	if err := updateManagedPackages(ctx, queries, desired, "laptop"); err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := previous("laptop"), []string{"git", "tlp"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("laptop after its sync = %v, want %v", got, want)
+	}
+	// The sync of laptop leaves the unclaimed records to the other hosts
+	if got, want := previous("tower"), []string{"git", "vim"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("tower = %v, want the unclaimed records %v", got, want)
+	}
+
+	if err := updateManagedPackages(ctx, queries, desired[:1], "tower"); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := previous("laptop"), []string{"git", "tlp"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("laptop after the sync of tower = %v, want %v", got, want)
+	}
+}
+
+func TestExclusionPrecedence(t *testing.T) {
+	tests := []struct {
+		name         string
+		files        map[string]string
+		wantPackages []string
+		wantExcluded []string
+	}{
+		{
+			name:         "host exclusion drops a global package",
+			files:        map[string]string{"base.pkgs": "git\nvim\n", "hosts/laptop.pkgs": "!vim\n"},
+			wantPackages: []string{"git"},
+			wantExcluded: []string{"vim"},
+		},
+		{
+			name:         "host declaration wins over a global exclusion",
+			files:        map[string]string{"base.pkgs": "git\n!vim\n", "hosts/laptop.pkgs": "vim\n"},
+			wantPackages: []string{"git", "vim"},
+		},
+		{
+			name:         "exclusion wins a tie",
+			files:        map[string]string{"base.pkgs": "git\nvim\n", "dev.pkgs": "!vim\n"},
+			wantPackages: []string{"git"},
+			wantExcluded: []string{"vim"},
+		},
+		{
+			name:         "exclusion wins a tie in the same file",
+			files:        map[string]string{"hosts/laptop.pkgs": "vim\n!vim\n"},
+			wantExcluded: []string{"vim"},
+		},
+		{
+			name:         "deeper file wins",
+			files:        map[string]string{"base.pkgs": "!vim\n", "editors/vim.pkgs": "vim\n"},
+			wantPackages: []string{"vim"},
+		},
+		{
+			name:         "group member excluded by name",
+			files:        map[string]string{"base.pkgs": "@editors\n", "hosts/laptop.pkgs": "!nano\n"},
+			wantPackages: []string{"vim"},
+			wantExcluded: []string{"nano"},
+		},
+		{
+			name:         "exclusion of another host is ignored",
+			files:        map[string]string{"base.pkgs": "vim\n", "hosts/tower.pkgs": "!vim\n"},
+			wantPackages: []string{"vim"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			defs := loadTestDefinitions(t, tt.files)
+			desired, excluded, err := buildDesiredPackagesFromDefs(defs, Machine{Hostname: "laptop"}, editorsGroup{})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if got := desiredNames(desired); !reflect.DeepEqual(got, tt.wantPackages) {
+				t.Errorf("packages = %v, want %v", got, tt.wantPackages)
+			}
+			var gotExcluded []string
+			for name := range excluded {
+				gotExcluded = append(gotExcluded, name)
+			}
+			if !reflect.DeepEqual(gotExcluded, tt.wantExcluded) {
+				t.Errorf("excluded = %v, want %v", gotExcluded, tt.wantExcluded)
+			}
+		})
+	}
+}
+
+// editorsGroup resolves the group editors to nano and vim
+type editorsGroup struct{}
+
+func (editorsGroup) GroupMembers(group string) ([]string, error) {
+	if group == "editors" {
+		return []string{"nano", "vim"}, nil
+	}
+	return nil, nil
+}
@@ -0,0 +1,187 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+)
+
+const maxSuggestions = 3
+
+// ValidationIssue is a package or group from the definitions that no
+// configured repository (nor any installed package) provides
+type ValidationIssue struct {
+	File        string
+	Line        int
+	Name        string
+	Group       bool
+	Suggestions []string
+}
+
+func (i ValidationIssue) String() string {
+	kind, name := "package", i.Name
+	if i.Group {
+		kind, name = "group", GROUP_PREFIX+i.Name
+	}
+
+	msg := fmt.Sprintf("%s:%d: unknown %s %q", i.File, i.Line, kind, name)
+	if len(i.Suggestions) > 0 {
+		msg += fmt.Sprintf(" (did you mean %s?)", strings.Join(i.Suggestions, ", "))
+	}
+	return msg
+}
+
+// validateDefinitions flags every package and group entry that cannot be
+// resolved from the sync databases or the installed packages
+func validateDefinitions(defs []Definition, available []SyncPackage, installed []InstalledPackage) []ValidationIssue {
+	knownPkgs := make(map[string]bool)
+	knownGroups := make(map[string]bool)
+	var pkgNames, groupNames []string
+
+	addPkg := func(name string, provides, groups []string) {
+		if !knownPkgs[name] {
+			pkgNames = append(pkgNames, name)
+		}
+		knownPkgs[name] = true
+		for _, p := range provides {
+			knownPkgs[p] = true
+		}
+		for _, g := range groups {
+			if !knownGroups[g] {
+				groupNames = append(groupNames, g)
+			}
+			knownGroups[g] = true
+		}
+	}
+	for _, pkg := range available {
+		addPkg(pkg.Name, pkg.Provides, pkg.Groups)
+	}
+	for _, pkg := range installed {
+		addPkg(pkg.Name, pkg.Provides, pkg.Groups)
+	}
+
+	var issues []ValidationIssue
+	for _, def := range defs {
+		for _, pkg := range def.Packages {
+			if !knownPkgs[pkg.Name] {
+				issues = append(issues, ValidationIssue{
+					File:        def.File,
+					Line:        pkg.Line,
+					Name:        pkg.Name,
+					Suggestions: suggest(pkg.Name, pkgNames),
+				})
+			}
+		}
+		for _, group := range def.Groups {
+			if !knownGroups[group.Name] {
+				issues = append(issues, ValidationIssue{
+					File:        def.File,
+					Line:        group.Line,
+					Name:        group.Name,
+					Group:       true,
+					Suggestions: suggest(group.Name, groupNames),
+				})
+			}
+		}
+	}
+
+	sort.SliceStable(issues, func(i, j int) bool {
+		if issues[i].File != issues[j].File {
+			return issues[i].File < issues[j].File
+		}
+		return issues[i].Line < issues[j].Line
+	})
+	return issues
+}
+
+// checkDefinitions validates the definitions before anything is installed.
+// Unknown names block the sync, unless an AUR helper may still provide them or
+// a repository they may come from could not be read.
+func checkDefinitions(defs []Definition, installed []InstalledPackage, appCtx *AppContext) error {
+	available, err := appCtx.Pacman.ListAvailable()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: skipping definition validation: %v\n", err)
+		return nil
+	}
+
+	issues := validateDefinitions(defs, available, installed)
+	if len(issues) == 0 {
+		return nil
+	}
+
+	for _, issue := range issues {
+		fmt.Fprintln(os.Stderr, issue)
+	}
+
+	if appCtx.Config.AurHelper != "" {
+		fmt.Fprintf(os.Stderr, "Warning: %d name(s) not found in the sync databases, assuming %s can find them in the AUR\n",
+			len(issues), appCtx.Config.AurHelper)
+		return nil
+	}
+
+	// Names of a repository that could not be read can't be verified
+	if skipped := appCtx.Pacman.SkippedRepos(); len(skipped) > 0 {
+		fmt.Fprintf(os.Stderr, "Warning: %d name(s) not found in the sync databases, they may come from %s, whose database could not be read\n",
+			len(issues), strings.Join(skipped, ", "))
+		return nil
+	}
+
+	return fmt.Errorf("%d name(s) not found in any configured repository", len(issues))
+}
+
+// suggest returns the candidates closest to name by edit distance
+func suggest(name string, candidates []string) []string {
+	maxDistance := max(2, len(name)/3)
+
+	type match struct {
+		name     string
+		distance int
+	}
+	var matches []match
+	for _, candidate := range candidates {
+		if d := levenshtein(name, candidate); d <= maxDistance {
+			matches = append(matches, match{candidate, d})
+		}
+	}
+
+	sort.Slice(matches, func(i, j int) bool {
+		if matches[i].distance != matches[j].distance {
+			return matches[i].distance < matches[j].distance
+		}
+		return matches[i].name < matches[j].name
+	})
+
+	suggestions := make([]string, 0, maxSuggestions)
+	for i := 0; i < len(matches) && i < maxSuggestions; i++ {
+		suggestions = append(suggestions, matches[i].name)
+	}
+	return suggestions
+}
+
+// levenshtein returns the edit distance between two strings
+func levenshtein(a, b string) int {
+	if a == b {
+		return 0
+	}
+
+	prev := make([]int, len(b)+1)
+	curr := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+
+	for i := 1; i <= len(a); i++ {
+		curr[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			curr[j] = min(prev[j]+1, curr[j-1]+1, prev[j-1]+cost)
+		}
+		prev, curr = curr, prev
+	}
+
+	return prev[len(b)]
+}
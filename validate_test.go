@@ -0,0 +1,43 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCheckDefinitions(t *testing.T) {
+	defs := []Definition{{File: "base.pkgs", Packages: []PackageEntry{{Name: "neovim", Line: 1}, {Name: "pacman", Line: 2}}}}
+	installed := fixtureInstalled(t)
+
+	tests := []struct {
+		name    string
+		repos   []string
+		zstd    bool
+		wantErr bool
+	}{
+		{name: "every package known", repos: []string{"core", "extra"}},
+		{name: "unknown package", repos: []string{"extra"}, wantErr: true},
+		// pacman may be in core, which can't be read
+		{name: "unverifiable package", repos: []string{"extra"}, zstd: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			root := t.TempDir()
+			for _, repo := range tt.repos {
+				writeSyncDB(t, root, repo, false)
+			}
+			if tt.zstd {
+				if err := os.WriteFile(filepath.Join(root, "sync", "core.db"), append(append([]byte{}, zstdMagic...), "data"...), 0o644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			appCtx := &AppContext{Config: &Config{}, Pacman: NewPacman(&Config{DBPath: root})}
+
+			if err := checkDefinitions(defs, installed, appCtx); (err != nil) != tt.wantErr {
+				t.Errorf("checkDefinitions() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
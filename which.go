@@ -0,0 +1,103 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"slices"
+)
+
+// Declaration is a definition line requesting a package
+type Declaration struct {
+	PackageSource
+	// Entry is the line as declared: the package itself or the "@group" including it
+	Entry string
+	// Scope is the host the definition is scoped to, or globalScope
+	Scope string
+	// Excluded is set when the group of Entry excludes the package with "!pkg"
+	Excluded bool
+	// Exclusion is set for a "!pkg" line, removing the package from the host's set
+	Exclusion bool
+	// When are the conditions of the [if] blocks enclosing the line
+	When Conditions
+}
+
+// Which lists every definition line declaring a package, directly or through a
+// group, and tells whether it applies to the host, this machine when empty
+func Which(name, host string, appCtx *AppContext) error {
+	defs, err := appCtx.PackageDef.LoadAllDefinitions()
+	if err != nil {
+		return fmt.Errorf("failed to load package definitions: %w", err)
+	}
+
+	hostname, err := currentHostname(host)
+	if err != nil {
+		return err
+	}
+
+	machine, err := newMachine(hostname, nil, appCtx)
+	if err != nil {
+		return err
+	}
+
+	decls := findDeclarations(defs, name, appCtx.Pacman)
+	if len(decls) == 0 {
+		return fmt.Errorf("%s is not declared in any definition file", name)
+	}
+
+	_, excluded, err := buildDesiredPackagesFromDefs(defs, machine, appCtx.Pacman)
+	if err != nil {
+		return fmt.Errorf("failed to resolve desired packages: %w", err)
+	}
+
+	var out bytes.Buffer
+	out.WriteString(buildWhichTable(decls, machine).String())
+	out.WriteString("\n")
+	if source, ok := excluded[name]; ok {
+		fmt.Fprintf(&out, "%s is excluded on %s by %s%s\n", name, hostname, source, describeWhen(source))
+	}
+	displayWithOptionalPager(appCtx, &out)
+	return nil
+}
+
+func findDeclarations(defs []Definition, name string, groups GroupResolver) []Declaration {
+	var decls []Declaration
+	for _, def := range defs {
+		for _, pkg := range def.Packages {
+			if pkg.Name == name {
+				decls = append(decls, Declaration{
+					PackageSource: def.Source(pkg.Line, pkg.Comment),
+					Entry:         pkg.Name,
+					Scope:         def.Scope(),
+					When:          pkg.When,
+				})
+			}
+		}
+
+		for _, pkg := range def.Excludes {
+			if pkg.Name == name {
+				decls = append(decls, Declaration{
+					PackageSource: def.Source(pkg.Line, pkg.Comment),
+					Entry:         EXCLUDE_PREFIX + pkg.Name,
+					Scope:         def.Scope(),
+					Exclusion:     true,
+					When:          pkg.When,
+				})
+			}
+		}
+
+		for _, group := range def.Groups {
+			members, err := groups.GroupMembers(group.Name)
+			if err != nil || !slices.Contains(members, name) {
+				continue
+			}
+			decls = append(decls, Declaration{
+				PackageSource: def.Source(group.Line, group.Comment),
+				Entry:         GROUP_PREFIX + group.Name,
+				Scope:         def.Scope(),
+				Excluded:      slices.Contains(group.Exclude, name),
+				When:          group.When,
+			})
+		}
+	}
+	return decls
+}